@@ -0,0 +1,243 @@
+package biblexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Node is an element in the parse tree.
+type Node interface {
+	Type() NodeType
+	// Position returns the source range of the node.
+	Position() Pos
+	// String returns the node in BibTeX syntax.
+	String() string
+}
+
+// NodeType identifies the type of a parse tree node.
+type NodeType int
+
+// Type returns itself and provides an easy default implementation
+// for embedding in a Node. Embedded in all non-trivial Nodes.
+func (t NodeType) Type() NodeType {
+	return t
+}
+
+// Position returns itself and provides an easy default implementation
+// for embedding in a Node. Embedded in all non-trivial Nodes.
+func (p Pos) Position() Pos {
+	return p
+}
+
+const (
+	NodeFile     NodeType = iota // the complete input
+	NodeEntry                    // a bibliography entry
+	NodeString                   // an @string macro definition
+	NodeField                    // a tag name and its value
+	NodeValue                    // a concatenation of text and macros
+	NodeText                     // delimited text
+	NodeMacro                    // a reference to a string macro
+	NodeComment                  // a @comment entry
+	NodePreamble                 // a @preamble entry
+	NodeNumber                   // a bare number
+)
+
+// Delim identifies the delimiters that enclose text.
+type Delim int
+
+const (
+	Braces Delim = iota // enclosed in { and }
+	Quotes              // text enclosed in " and "
+	Parens              // entry enclosed in ( and )
+)
+
+// delims returns the opening and closing delimiters.
+func (d Delim) delims() (string, string) {
+	switch d {
+	case Quotes:
+		return `"`, `"`
+	case Parens:
+		return "(", ")"
+	}
+	return "{", "}"
+}
+
+// FileNode holds the top-level nodes of a .bib file in input order.
+type FileNode struct {
+	NodeType
+	Pos
+	Name        string       // the name of the input
+	Nodes       []Node       // the entries, @string definitions, @preamble and @comment entries
+	Macros      *MacroTable  // the macros defined by the @string definitions
+	Diagnostics []Diagnostic // the problems found in entries, such as duplicate fields
+}
+
+func (f *FileNode) String() string {
+	var sb strings.Builder
+	for _, n := range f.Nodes {
+		sb.WriteString(n.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Preambles returns the @preamble entries of the file in input order.
+func (f *FileNode) Preambles() []*PreambleNode {
+	var preambles []*PreambleNode
+	for _, n := range f.Nodes {
+		if p, ok := n.(*PreambleNode); ok {
+			preambles = append(preambles, p)
+		}
+	}
+	return preambles
+}
+
+// EntryNode holds a bibliography entry such as @article.
+type EntryNode struct {
+	NodeType
+	Pos
+	EntryType string       // the entry type, as written
+	Delim     Delim        // the entry delimiters; Braces or Parens
+	Key       string       // the cite key
+	Fields    []*FieldNode // the fields, in input order
+}
+
+// Field returns the first field with the given name, ignoring case,
+// or nil if the entry has no such field.
+func (e *EntryNode) Field(name string) *FieldNode {
+	for _, f := range e.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (e *EntryNode) String() string {
+	var sb strings.Builder
+	open, close := e.Delim.delims()
+	fmt.Fprintf(&sb, "@%s%s%s,\n", e.EntryType, open, e.Key)
+	for _, f := range e.Fields {
+		fmt.Fprintf(&sb, "  %s,\n", f)
+	}
+	sb.WriteString(close)
+	return sb.String()
+}
+
+// StringNode holds an @string macro definition.
+type StringNode struct {
+	NodeType
+	Pos
+	EntryType string     // the entry type, as written
+	Delim     Delim      // the entry delimiters; Braces or Parens
+	Key       string     // the name of the macro
+	Value     *ValueNode // the value of the macro
+}
+
+func (s *StringNode) String() string {
+	open, close := s.Delim.delims()
+	return fmt.Sprintf("@%s%s%s = %s%s", s.EntryType, open, s.Key, s.Value, close)
+}
+
+// CommentNode holds a @comment entry. The text is kept verbatim,
+// so that tools storing metadata in comments, such as JabRef,
+// find it unchanged when the entry is written back out.
+type CommentNode struct {
+	NodeType
+	Pos
+	EntryType string // the entry type, as written
+	Delim     Delim  // the entry delimiters; Braces or Parens
+	Text      string // the body of the comment, without the entry delimiters
+}
+
+func (c *CommentNode) String() string {
+	open, close := c.Delim.delims()
+	return fmt.Sprintf("@%s%s%s%s", c.EntryType, open, c.Text, close)
+}
+
+// PreambleNode holds a @preamble entry.
+type PreambleNode struct {
+	NodeType
+	Pos
+	EntryType string     // the entry type, as written
+	Delim     Delim      // the entry delimiters; Braces or Parens
+	Value     *ValueNode // the value of the preamble; nil if empty
+}
+
+func (p *PreambleNode) String() string {
+	open, close := p.Delim.delims()
+	if p.Value == nil {
+		return fmt.Sprintf("@%s%s%s", p.EntryType, open, close)
+	}
+	return fmt.Sprintf("@%s%s%s%s", p.EntryType, open, p.Value, close)
+}
+
+// FieldNode holds a tag name and its value.
+type FieldNode struct {
+	NodeType
+	Pos
+	Name  string     // the tag name
+	Value *ValueNode // the value of the tag
+}
+
+func (f *FieldNode) String() string {
+	return fmt.Sprintf("%s = %s", f.Name, f.Value)
+}
+
+// ValueNode holds the operands of a value concatenated with #.
+// Each part is a *TextNode, a *NumberNode or a *MacroNode.
+type ValueNode struct {
+	NodeType
+	Pos
+	Parts    []Node
+	Expanded string // the concatenated parts with macros expanded
+}
+
+func (v *ValueNode) String() string {
+	parts := make([]string, len(v.Parts))
+	for i, p := range v.Parts {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, " # ")
+}
+
+// TextNode holds text enclosed in braces or quotes.
+type TextNode struct {
+	NodeType
+	Pos
+	Delim Delim  // the enclosing delimiters
+	Text  string // the text without the enclosing delimiters
+}
+
+func (t *TextNode) String() string {
+	open, close := t.Delim.delims()
+	return open + t.Text + close
+}
+
+// NumberNode holds a bare number, such as the value of year = 2020.
+// Like text, numbers are literals, not references to macros.
+type NumberNode struct {
+	NodeType
+	Pos
+	Text string // the digits of the number
+}
+
+func (n *NumberNode) String() string {
+	return n.Text
+}
+
+// MacroNode holds a reference to a string macro.
+type MacroNode struct {
+	NodeType
+	Pos
+	Name string // the name of the macro
+}
+
+func (m *MacroNode) String() string {
+	return m.Name
+}
+
+// span returns the source range from the start of a to the end of b.
+func span(a, b Pos) Pos {
+	return Pos{a.Offset, a.Line, a.Column, b.End}
+}
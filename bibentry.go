@@ -1,23 +1,14 @@
 package biblexer
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// type bibtype string
-
-//XXgo:generate stringer -type=bibtype
-// const (
-// 	article bibtype = iota
-// 	book
-// 	misc
-// 	proceedings
-// 	inproceedings
-// )
-
-// var btypes = [...]string{"article", "book", "misc", "proceedings", "inproceedings"}
-
 var btypes = map[string]bool{
 	"article":       true,
 	"book":          true,
@@ -26,11 +17,254 @@ var btypes = map[string]bool{
 	"inproceedings": true,
 }
 
-type bibentry struct {
-	bibtype string
-	citekey string
-	author  string
-	title   string
-	date    time.Time
-	pdf     url.URL
+// Entry is a bibliography entry decoded from an EntryNode.
+type Entry struct {
+	Type   string    // the entry type, in lower case
+	Key    string    // the cite key
+	Date   time.Time // the date, from the date field or the year, month and day fields
+	PDF    url.URL   // the location of the document, from the pdf, file or url field
+	Fields Fields    // the fields with macros expanded, in input order
+}
+
+// Author returns the author field.
+func (e *Entry) Author() string { return e.Fields.Get("author") }
+
+// Editor returns the editor field.
+func (e *Entry) Editor() string { return e.Fields.Get("editor") }
+
+// AuthorNames returns the names in the author field.
+func (e *Entry) AuthorNames() []Name { return ParseNames(e.Author()) }
+
+// EditorNames returns the names in the editor field.
+func (e *Entry) EditorNames() []Name { return ParseNames(e.Editor()) }
+
+// Title returns the title field.
+func (e *Entry) Title() string { return e.Fields.Get("title") }
+
+// Journal returns the journal field.
+func (e *Entry) Journal() string { return e.Fields.Get("journal") }
+
+// Booktitle returns the booktitle field.
+func (e *Entry) Booktitle() string { return e.Fields.Get("booktitle") }
+
+// Publisher returns the publisher field.
+func (e *Entry) Publisher() string { return e.Fields.Get("publisher") }
+
+// Year returns the year field.
+func (e *Entry) Year() string { return e.Fields.Get("year") }
+
+// Volume returns the volume field.
+func (e *Entry) Volume() string { return e.Fields.Get("volume") }
+
+// Number returns the number field.
+func (e *Entry) Number() string { return e.Fields.Get("number") }
+
+// Pages returns the pages field.
+func (e *Entry) Pages() string { return e.Fields.Get("pages") }
+
+// DOI returns the doi field.
+func (e *Entry) DOI() string { return e.Fields.Get("doi") }
+
+// Fields is an ordered map from field names to values. Field names are
+// case-insensitive and stored in lower case. The zero value is empty
+// and ready to use.
+type Fields struct {
+	names  []string
+	values map[string]string
+}
+
+// Get returns the value of the named field, or the empty string.
+func (f *Fields) Get(name string) string {
+	return f.values[strings.ToLower(name)]
+}
+
+// Lookup returns the value of the named field, and whether it is present.
+func (f *Fields) Lookup(name string) (string, bool) {
+	v, ok := f.values[strings.ToLower(name)]
+	return v, ok
+}
+
+// Set sets the value of the named field. A new field is added after
+// the existing fields; an existing field keeps its place.
+func (f *Fields) Set(name, value string) {
+	name = strings.ToLower(name)
+	if f.values == nil {
+		f.values = make(map[string]string)
+	}
+	if _, ok := f.values[name]; !ok {
+		f.names = append(f.names, name)
+	}
+	f.values[name] = value
+}
+
+// Delete removes the named field.
+func (f *Fields) Delete(name string) {
+	name = strings.ToLower(name)
+	if _, ok := f.values[name]; !ok {
+		return
+	}
+	delete(f.values, name)
+	for i, n := range f.names {
+		if n == name {
+			f.names = append(f.names[:i:i], f.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// Names returns the field names in order.
+func (f *Fields) Names() []string {
+	return f.names
+}
+
+// Len returns the number of fields.
+func (f *Fields) Len() int {
+	return len(f.names)
+}
+
+// FieldError describes a field value that could not be decoded.
+type FieldError struct {
+	Pos   Pos    // the position of the field
+	Key   string // the cite key of the entry
+	Field string // the name of the field
+	Value string // the expanded value of the field
+	Err   error  // the reason the value could not be decoded
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s: invalid %s %q: %v", e.Pos, e.Key, e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// fieldError returns a *FieldError for the named field of the entry n.
+func fieldError(n *EntryNode, name string, err error) error {
+	f := n.Field(name)
+	return &FieldError{Pos: f.Pos, Key: n.Key, Field: f.Name, Value: f.Value.Expanded, Err: err}
+}
+
+// Decode decodes the entries of the parse tree f, skipping @string,
+// @preamble and @comment entries. Entries with fields that cannot be
+// decoded are still returned; the errors for such fields are joined
+// in the returned error.
+func Decode(f *FileNode) ([]Entry, error) {
+	var entries []Entry
+	var errs []error
+	for _, n := range f.Nodes {
+		if n, ok := n.(*EntryNode); ok {
+			e, err := DecodeEntry(n)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, errors.Join(errs...)
+}
+
+// DecodeEntry decodes the entry node n. As in BibTeX, only the first of
+// duplicate fields is kept. The date and document location are decoded
+// from their fields; if those cannot be decoded, the entry is returned
+// with a *FieldError.
+func DecodeEntry(n *EntryNode) (Entry, error) {
+	e := Entry{Type: strings.ToLower(n.EntryType), Key: n.Key}
+	for _, f := range n.Fields {
+		if _, ok := e.Fields.Lookup(f.Name); !ok {
+			e.Fields.Set(f.Name, f.Value.Expanded)
+		}
+	}
+	var errs []error
+	if date, name, err := decodeDate(&e.Fields); err != nil {
+		errs = append(errs, fieldError(n, name, err))
+	} else {
+		e.Date = date
+	}
+	for _, name := range [...]string{"pdf", "file", "url"} {
+		if v, ok := e.Fields.Lookup(name); ok {
+			u, err := decodeURL(name, v)
+			if err != nil {
+				errs = append(errs, fieldError(n, name, err))
+				break
+			}
+			e.PDF = *u
+			break
+		}
+	}
+	return e, errors.Join(errs...)
+}
+
+// dateLayouts are the accepted layouts of the date field.
+var dateLayouts = [...]string{"2006-01-02", "2006-01", "2006"}
+
+// decodeDate returns the date given by the date field, or else by the
+// year, month and day fields. On error, it returns the name of the
+// offending field.
+func decodeDate(f *Fields) (time.Time, string, error) {
+	if v, ok := f.Lookup("date"); ok {
+		// use the start of a date range
+		v, _, _ = strings.Cut(strings.TrimSpace(v), "/")
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, "", nil
+			}
+		}
+		return time.Time{}, "date", errors.New("not a date")
+	}
+	v, ok := f.Lookup("year")
+	if !ok {
+		return time.Time{}, "", nil
+	}
+	year, err := strconv.Atoi(strings.Trim(v, "{} "))
+	if err != nil {
+		return time.Time{}, "year", errors.New("not a year")
+	}
+	month := time.January
+	if v, ok := f.Lookup("month"); ok {
+		if month, ok = parseMonth(v); !ok {
+			return time.Time{}, "month", errors.New("not a month")
+		}
+	}
+	day := 1
+	if v, ok := f.Lookup("day"); ok {
+		day, err = strconv.Atoi(strings.Trim(v, "{} "))
+		if err != nil || day < 1 || day > 31 {
+			return time.Time{}, "day", errors.New("not a day")
+		}
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), "", nil
+}
+
+// parseMonth parses a month given by number, name or abbreviation,
+// such as 10, October, oct or Oct.
+func parseMonth(s string) (time.Month, bool) {
+	s = strings.Trim(s, "{}. ")
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Month(n), n >= 1 && n <= 12
+	}
+	if len(s) < 3 {
+		return 0, false
+	}
+	for m := time.January; m <= time.December; m++ {
+		name := m.String()
+		if len(s) <= len(name) && strings.EqualFold(s, name[:len(s)]) {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+// decodeURL parses the value of the named field as a URL. The file field
+// may use JabRef's description:path:type format, in which case the path
+// of the first file is used.
+func decodeURL(name, v string) (*url.URL, error) {
+	v = strings.TrimSpace(v)
+	if name == "file" && !strings.Contains(v, "://") {
+		v, _, _ = strings.Cut(v, ";")
+		if parts := strings.Split(v, ":"); len(parts) >= 3 {
+			v = strings.Join(parts[1:len(parts)-1], ":")
+		}
+	}
+	return url.Parse(v)
 }
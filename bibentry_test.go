@@ -0,0 +1,104 @@
+package biblexer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var decodeInput = `@string{goconf = "GopherCon"}
+@Article{meling72,
+	author = {Hein Meling},
+	Title = {The wonderful paper},
+	year = 1972, month = oct, day = 5,
+	journal = goconf,
+	pdf = {https://example.com/paper.pdf},
+}
+@inproceedings{k2, title = {Second}, date = {2020-03/2020-04}, file = {Paper:papers/k2.pdf:PDF}}
+@misc{k3, note = {no date}, url = {https://go.dev/}}
+@misc{k4, year = {nineteen}, month = 13}
+`
+
+func TestDecode(t *testing.T) {
+	p := NewParser(NewLexer("bib", decodeInput))
+	p.Macros().Enable(MonthMacros)
+	f, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := Decode(f)
+	if len(entries) != 4 {
+		t.Fatalf("Got %d entries, expected 4", len(entries))
+	}
+	var ferr *FieldError
+	if !errors.As(err, &ferr) || ferr.Key != "k4" || ferr.Field != "year" {
+		t.Errorf("Got %v, expected error for the year of k4", err)
+	}
+
+	e := entries[0]
+	if e.Type != "article" || e.Key != "meling72" || e.Author() != "Hein Meling" || e.Title() != "The wonderful paper" || e.Journal() != "GopherCon" {
+		t.Errorf("Got %+v", e)
+	}
+	if want := time.Date(1972, time.October, 5, 0, 0, 0, 0, time.UTC); !e.Date.Equal(want) {
+		t.Errorf("Got %v, expected %v", e.Date, want)
+	}
+	if got := e.PDF.String(); got != "https://example.com/paper.pdf" {
+		t.Errorf("Got %s, expected %s", got, "https://example.com/paper.pdf")
+	}
+	names := []string{"author", "title", "year", "month", "day", "journal", "pdf"}
+	if got := e.Fields.Names(); len(got) != len(names) {
+		t.Errorf("Got %v, expected %v", got, names)
+	} else {
+		for i := range names {
+			if got[i] != names[i] {
+				t.Errorf("Got %v, expected %v", got, names)
+				break
+			}
+		}
+	}
+
+	e = entries[1]
+	if want := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC); !e.Date.Equal(want) {
+		t.Errorf("Got %v, expected %v", e.Date, want)
+	}
+	if got := e.PDF.String(); got != "papers/k2.pdf" {
+		t.Errorf("Got %s, expected %s", got, "papers/k2.pdf")
+	}
+	e = entries[2]
+	if !e.Date.IsZero() || e.PDF.Host != "go.dev" {
+		t.Errorf("Got %v and %v, expected no date and go.dev", e.Date, e.PDF)
+	}
+}
+
+func TestDecodeDuplicateFields(t *testing.T) {
+	f, err := Parse("bib", `@misc{k, title = {A}, title = {B}, year = 1999, year = {x}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := f.Nodes[0].(*EntryNode)
+	e, err := DecodeEntry(n)
+	if err != nil {
+		t.Errorf("Got %v, expected no error", err)
+	}
+	if e.Title() != "A" || n.Field("title").Value.Expanded != "A" || e.Fields.Get("year") != "1999" {
+		t.Errorf("Got title %q and year %q, expected the first fields", e.Title(), e.Fields.Get("year"))
+	}
+	if diags := f.Diagnostics; len(diags) != 2 || len(f.Macros.Diagnostics()) != 0 {
+		t.Errorf("Got %v, expected 2 duplicate fields", diags)
+	}
+}
+
+func TestFields(t *testing.T) {
+	var f Fields
+	f.Set("Author", "A")
+	f.Set("title", "T")
+	f.Set("AUTHOR", "B")
+	f.Set("year", "1972")
+	f.Delete("title")
+	if f.Len() != 2 || f.Names()[0] != "author" || f.Names()[1] != "year" || f.Get("author") != "B" {
+		t.Errorf("Got %v with author %q", f.Names(), f.Get("author"))
+	}
+	if _, ok := f.Lookup("title"); ok {
+		t.Errorf("Got title, expected it to be deleted")
+	}
+}
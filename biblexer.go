@@ -5,9 +5,6 @@ import (
 	"strings"
 )
 
-//TODO: Add support for ignoring comments later
-//TODO: Add support @preamble, @comment
-
 // itemType identifies the type of lex items.
 type itemType int
 
@@ -15,6 +12,7 @@ type itemType int
 type item struct {
 	typ itemType
 	val string
+	pos Pos
 }
 
 func (i item) String() string {
@@ -31,7 +29,7 @@ func (i item) String() string {
 const (
 	itemError itemType = iota // error occurred; value is text of error
 	itemEOF
-	itemComment              // delimiter for comments (%)
+	itemComment              // a comment, from % to the end of the line
 	itemEntryTypeDelim       // entry type delimiter (@)
 	itemEntryType            // the entry type
 	itemEntryStartDelim      // entry start delimiter ({)
@@ -46,64 +44,203 @@ const (
 	itemQuoteDelim           // content start/stop delimiter (")
 	itemConcat               // the concatination symbol (#)
 	itemStringKey            // string macro key
+	itemCommentEntry         // the verbatim body of a @comment entry
+	itemNumber               // a bare number used as content (year = 2020)
+	itemSpace                // white space between tokens, when keeping trivia
+	itemJunk                 // text between entries, when keeping trivia
 )
 
+// Kind identifies the kind of a Token.
+type Kind int
+
+// The kinds of tokens returned by Lexer.NextToken.
+// Each kind corresponds to one of the item types above.
+const (
+	Error                = Kind(itemError)                // error occurred; value is text of error
+	EOF                  = Kind(itemEOF)                  // end of input
+	Comment              = Kind(itemComment)              // a comment, from % to the end of the line
+	EntryTypeDelim       = Kind(itemEntryTypeDelim)       // entry type delimiter (@)
+	EntryType            = Kind(itemEntryType)            // the entry type
+	EntryStartDelim      = Kind(itemEntryStartDelim)      // entry start delimiter ({)
+	EntryStopDelim       = Kind(itemEntryStopDelim)       // entry stop delimiter (})
+	CiteKey              = Kind(itemCiteKey)              // the cite key
+	TagName              = Kind(itemTagName)              // the tag name (on left of =)
+	Equal                = Kind(itemEqual)                // delimiter separating name and content (=)
+	TagContent           = Kind(itemTagContent)           // the content for the tag
+	Comma                = Kind(itemComma)                // delimiter separating name-content pairs or tags (,)
+	TagContentStartDelim = Kind(itemTagContentStartDelim) // content start delimiter ({)
+	TagContentStopDelim  = Kind(itemTagContentStopDelim)  // content stop delimiter (})
+	QuoteDelim           = Kind(itemQuoteDelim)           // content start/stop delimiter (")
+	Concat               = Kind(itemConcat)               // the concatination symbol (#)
+	StringKey            = Kind(itemStringKey)            // string macro key
+	CommentEntry         = Kind(itemCommentEntry)         // the verbatim body of a @comment entry
+	Number               = Kind(itemNumber)               // a bare number used as content (year = 2020)
+	Space                = Kind(itemSpace)                // white space between tokens, when keeping trivia
+	Junk                 = Kind(itemJunk)                 // text between entries, when keeping trivia
+)
+
+// String returns the name of the kind, e.g. "CiteKey".
+func (k Kind) String() string {
+	if k < 0 || k > Junk {
+		return fmt.Sprintf("Kind(%d)", k)
+	}
+	return strings.TrimPrefix(itemType(k).String(), "item")
+}
+
+// Token represents a token or text string returned from the Lexer.
+type Token struct {
+	Kind Kind   // the kind of this token
+	Val  string // the token text; for Error tokens, the text of the error
+	Pos  Pos    // the source range of the token
+}
+
+func (t Token) String() string {
+	return item{itemType(t.Kind), t.Val, t.Pos}.String()
+}
+
 // state functions
 
 const (
 	commentDelim = "%"
+	digits       = "0123456789"
 )
 
 // lexStart scans the input for bibtex entries.
 // lexStart scans until an entry type delimiter "@" is found, and
 // starts to process the rest of the bibtex entries in the input.
-func lexStart(l *lexer) stateFn {
+func lexStart(l *Lexer) stateFn {
 	for {
-		if strings.HasPrefix(l.input[l.pos:], "@") {
-			if l.pos > l.start {
-				// ignore anything that comes before the @ delimiter.
-				l.ignore()
-			}
+		switch r := l.next(); {
+		case r == '@':
+			l.backup()
+			l.ignoreJunk()
 			l.emit1(itemEntryTypeDelim) // absorb '@'
 			return lexEntryType
-		}
-		if l.next() == eof {
+		case r == '%' && l.prevBlank:
+			// a comment line; any other % is part of the text between entries
+			l.backup()
+			l.ignoreJunk()
+			l.lexComment()
+			return lexStart
+		case r == eof:
+			l.ignoreJunk()
 			l.emit(itemEOF)
 			return nil
 		}
+		if !l.trivia {
+			// ignore anything that comes before the @ delimiter.
+			l.ignore()
+		}
+	}
+}
+
+// ignoreJunk skips over the text before an entry, or emits it as
+// white space or junk when keeping trivia.
+func (l *Lexer) ignoreJunk() {
+	if strings.TrimLeft(l.input[l.start:l.pos], " \t\r\n") == "" {
+		l.ignoreTrivia(itemSpace)
+		return
+	}
+	l.ignoreTrivia(itemJunk)
+}
+
+// lexRecover skips the rest of an entry in error, starting with the
+// token in which the error occurred, up to the next @ that starts a
+// line, where it resumes the scan.
+func lexRecover(l *Lexer) stateFn {
+	l.pos, l.line, l.lineStart, l.blank, l.skip = l.start, l.startLine, l.startLineStart, l.startBlank, 0
+	for {
+		switch r := l.next(); {
+		case r == '@' && l.prevBlank:
+			l.backup()
+			l.ignoreJunk()
+			return lexStart
+		case r == eof:
+			l.ignoreJunk()
+			return lexStart
+		}
+		if !l.trivia {
+			l.ignore()
+		}
 	}
 }
 
 // lexEntryType scans the entry type.
-func lexEntryType(l *lexer) stateFn {
+func lexEntryType(l *Lexer) stateFn {
 	l.ignoreSpaces()
 	for {
 		switch r := l.next(); {
 		case l.isUnbrokenAlphaNumericToken(r):
 			// absorb and emit when delimiter is found
-		case r == '{':
+		case r == '{' || r == '(':
 			l.backup()
+			typ := l.input[l.start : l.pos-l.skip]
 			l.emit(itemEntryType)
-			l.emit1(itemEntryStartDelim) // absorb '{'
+			// the entry must be closed by the delimiter matching r
+			l.entryStop = '}'
+			if r == '(' {
+				l.entryStop = ')'
+			}
+			l.emit1(itemEntryStartDelim) // absorb '{' or '('
+			switch {
+			case strings.EqualFold(typ, "comment"):
+				return lexCommentEntry
+			case strings.EqualFold(typ, "preamble"):
+				return lexPreamble
+			}
 			return lexCiteKey
 		case isSpace(r):
 			// discard spaces after entry type (to avoid emitting with spaces)
 			l.discard()
-		case r == eof:
-			return l.errorf("unexpected eof at line %d", l.lineNumber())
 		default:
-			return l.errorf("unexpected character %#U at line %d", r, l.lineNumber())
+			return l.errorf(r, StateEntryType, EntryType, EntryStartDelim)
 		}
 	}
 }
 
+// lexCommentEntry scans the body of a @comment entry verbatim, up to
+// the entry stop delimiter that is not enclosed in braces, or in
+// parentheses if the entry is delimited by them.
+func lexCommentEntry(l *Lexer) stateFn {
+	braces, parens := 0, 0
+	for {
+		switch r := l.next(); {
+		case r == '{':
+			braces++
+		case r == '}' && braces > 0:
+			braces--
+		case r == '(' && l.entryStop == ')':
+			parens++
+		case r == ')' && parens > 0:
+			parens--
+		case r == l.entryStop && braces == 0:
+			l.backup()
+			l.emit(itemCommentEntry)
+			l.emit1(itemEntryStopDelim) // absorb '}' or ')'
+			return lexStart
+		case r == eof:
+			return l.unclosedf(opening(l.entryStop), StateComment, CommentEntry, EntryStopDelim)
+		}
+	}
+}
+
+// lexPreamble scans the value of a @preamble entry, which is lexed
+// like the content of a tag, including concatenation with #.
+func lexPreamble(l *Lexer) stateFn {
+	l.ignoreSpaces()
+	if l.peek() == l.entryStop {
+		// empty preamble
+		l.emit1(itemEntryStopDelim) // absorb '}' or ')'
+		return lexStart
+	}
+	return lexTagContentStartDelim
+}
+
 // lexCiteKey scans the cite key.
-func lexCiteKey(l *lexer) stateFn {
+func lexCiteKey(l *Lexer) stateFn {
 	l.ignoreSpaces()
 	for {
 		switch r := l.next(); {
-		case l.isUnbrokenAlphaNumericToken(r):
-			// absorb and emit when delimiter is found
 		case r == ',':
 			l.backup()
 			l.emit(itemCiteKey)
@@ -117,26 +254,28 @@ func lexCiteKey(l *lexer) stateFn {
 		case isSpace(r):
 			// discard spaces after cite key (to avoid emitting with spaces)
 			l.discard()
-		case r == eof:
-			return l.errorf("unexpected eof at line %d", l.lineNumber())
+		case l.isUnbrokenKeyToken(r):
+			// absorb and emit when delimiter is found
 		default:
-			return l.errorf("unexpected character %#U at line %d", r, l.lineNumber())
+			return l.errorf(r, StateCiteKey, CiteKey, StringKey, Comma, Equal)
 		}
 	}
 }
 
 // lexTagName scans the tag name.
-func lexTagName(l *lexer) stateFn {
+func lexTagName(l *Lexer) stateFn {
 	l.ignoreSpaces()
 	for {
-		if strings.HasPrefix(l.input[l.pos:], "}") {
-			l.emit1(itemEntryStopDelim) // absorb '}'
+		if l.peek() == l.entryStop {
+			if l.pos > l.start || l.skip > 0 {
+				// a tag name without '=' and content
+				return l.errorf(l.next(), StateTagName, Equal)
+			}
+			l.emit1(itemEntryStopDelim) // absorb '}' or ')'
 			// search for the next bib entry
 			return lexStart
 		}
 		switch r := l.next(); {
-		case l.isUnbrokenAlphaNumericToken(r):
-			// absorb and emit when delimiter is found
 		case r == '=':
 			l.backup()
 			l.emit(itemTagName)
@@ -145,101 +284,119 @@ func lexTagName(l *lexer) stateFn {
 		case isSpace(r):
 			// discard spaces after tag name (to avoid emitting with spaces)
 			l.discard()
-		case r == eof:
-			return l.errorf("unexpected eof at line %d", l.lineNumber())
+		case l.isUnbrokenKeyToken(r):
+			// absorb and emit when delimiter is found
 		default:
-			return l.errorf("unexpected character %#U at line %d", r, l.lineNumber())
+			return l.errorf(r, StateTagName, TagName, Equal, EntryStopDelim)
 		}
 	}
 }
 
-// lexTagContentStartDelim scans the name-content start delimiter.
-func lexTagContentStartDelim(l *lexer) stateFn {
+// lexTagContentStartDelim scans the start of an operand of a tag's content.
+// The content is a sequence of operands joined by the concatenation symbol;
+// each operand is a braced or quoted string, a number or a string macro.
+func lexTagContentStartDelim(l *Lexer) stateFn {
 	l.ignoreSpaces()
-	for {
-		switch r := l.next(); {
-		case l.isUnbrokenAlphaNumericToken(r):
-			// absorb and emit when delimiter is found
-		case r == '"':
-			l.emit(itemQuoteDelim)
-			return lexTagContent
-		case r == '{':
-			l.emit(itemTagContentStartDelim)
-			return lexTagContent
-		case r == '}':
-			// handle @string key as the last element of a tag
-			l.backup()
-			l.emit(itemStringKey)
-			return lexTagName
-		case r == '#': // Concatination support for @string macros
-			l.backup()
-			l.emit(itemStringKey)
-			l.emit1(itemConcat) // absorb '#'
-			return lexTagContentStartDelim
-		case isSpace(r):
-			// discard spaces after tag name (to avoid emitting with spaces)
-			l.discard()
-		case r == eof:
-			return l.errorf("unexpected eof at line %d", l.lineNumber())
-		default:
-			return l.errorf("unexpected character %#U at line %d", r, l.lineNumber())
-		}
+	switch r := l.next(); {
+	case r == '"':
+		l.emit(itemQuoteDelim)
+		l.contentStop = '"'
+		return lexTagContent
+	case r == '{':
+		l.emit(itemTagContentStartDelim)
+		l.contentStop = '}'
+		return lexTagContent
+	case strings.ContainsRune(digits, r):
+		l.backup()
+		return lexNumber
+	case r != eof && l.isKey(r):
+		l.backup()
+		return lexStringKey
+	default:
+		return l.errorf(r, StateContentStart, TagContentStartDelim, QuoteDelim, StringKey, Number)
 	}
 }
 
-// lexTagContent scans the elements inside the content.
-func lexTagContent(l *lexer) stateFn {
-	l.ignoreSpaces()
+// lexNumber scans a bare number used as the content of a tag.
+func lexNumber(l *Lexer) stateFn {
+	l.acceptRun(digits)
+	l.emit(itemNumber)
+	return lexTagDelim
+}
+
+// lexStringKey scans a reference to a string macro used as the content of a tag.
+func lexStringKey(l *Lexer) stateFn {
+	for r := l.next(); r != eof && l.isKey(r); r = l.next() {
+		// absorb and emit when delimiter is found
+	}
+	l.backup()
+	l.emit(itemStringKey)
+	return lexTagDelim
+}
+
+// lexTagContent scans the elements inside a braced or quoted string,
+// up to the content stop delimiter that is not enclosed in braces.
+func lexTagContent(l *Lexer) stateFn {
 	braces := 0
 	for {
 		switch r := l.next(); {
-		case isAlphaNumeric(r) || isSpace(r):
-			// absorb and emit when delimiter is found
 		case r == '{':
 			braces++
 			// absorb internal brace
 		case r == '}' && braces > 0:
 			braces--
 			// absorb internal brace
-		case r == '"':
+		case r == '"' && braces == 0 && l.contentStop == '"':
 			l.backup()
 			l.emit(itemTagContent)
 			l.emit1(itemQuoteDelim) // absorb '"'
 			return lexTagDelim
-		case r == '}':
+		case r == '}' && l.contentStop == '}':
 			l.backup()
 			l.emit(itemTagContent)
 			l.emit1(itemTagContentStopDelim) // absorb '}'
 			return lexTagDelim
-		case r == eof:
-			return l.errorf("unexpected eof at line %d", l.lineNumber())
+		case r == '}':
+			// unbalanced '}' in a quoted string
+			return l.errorf(r, StateContent, TagContent, TagContentStopDelim, QuoteDelim)
+		case r == eof || r == '@' && l.recover && l.prevBlank:
+			// unterminated string
+			return l.unclosedf(opening(l.contentStop), StateContent, TagContent, TagContentStopDelim, QuoteDelim)
 		default:
-			return l.errorf("unexpected character %#U at line %d", r, l.lineNumber())
+			// absorb and emit when delimiter is found
 		}
 	}
 }
 
+// opening returns the opening delimiter that matches the stop delimiter.
+func opening(stop rune) rune {
+	switch stop {
+	case '}':
+		return '{'
+	case ')':
+		return '('
+	}
+	return stop
+}
+
 // lexTagDelim scans the tag delimiter.
-func lexTagDelim(l *lexer) stateFn {
+func lexTagDelim(l *Lexer) stateFn {
 	l.ignoreSpaces()
 	for {
 		switch r := l.next(); {
 		case r == ',':
 			l.emit(itemComma)
 			return lexTagName
-		case r == '}':
+		case r == l.entryStop:
 			// handle last name-content pair without ',' delimiter in lexTagName
 			l.backup()
 			return lexTagName
 		case r == '#': // Concatination support for content strings
 			l.backup()
-			// l.emit(itemTagContent) //TODO: This was a bug in one case, check others
 			l.emit1(itemConcat) // absorb '#'
 			return lexTagContentStartDelim
-		case r == eof:
-			return l.errorf("unexpected eof at line %d", l.lineNumber())
 		default:
-			return l.errorf("unexpected character %#U at line %d", r, l.lineNumber())
+			return l.errorf(r, StateTagDelim, Comma, Concat, EntryStopDelim)
 		}
 	}
 }
@@ -1,8 +1,15 @@
 package biblexer
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"unsafe"
 )
 
 // passSet1 contains entries that all should produce
@@ -307,7 +314,7 @@ var expectedSet7 = []itemType{
 var passSet8 = []string{
 	`@string{ gopher = "Mrs. Gopher" }
 	 @string{ pike = "Mr. Gopher"	}
-	 @article{c72, author = gopher # pike }`, // KNOWN ISSUE: CANNOT END WITH STRING MACRO
+	 @article{c72, author = gopher # pike }`,
 }
 
 // expectedSet8 is the sequence of tokens expected for each entry in passSet8.
@@ -344,6 +351,177 @@ var expectedSet8 = []itemType{
 	itemEOF,
 }
 
+var passSet9 = []string{
+	`@comment{jabref-meta: databaseType:bibtex;}
+	 @article{c72, author = {Gopher}}`,
+	`@Comment{ {nested} braces, "quotes" and @ signs }
+	 @article{c72, author = {Gopher}}`,
+	`@comment(foo (bar) baz)
+	 @article{c72, author = {Gopher}}`,
+}
+
+// expectedSet9 is the sequence of tokens expected for each entry in passSet9.
+var expectedSet9 = []itemType{
+	itemEntryTypeDelim, // @comment{...}
+	itemEntryType,
+	itemEntryStartDelim,
+	itemCommentEntry,
+	itemEntryStopDelim,
+	itemEntryTypeDelim, // @article{c72, author = {Gopher}}
+	itemEntryType,
+	itemEntryStartDelim,
+	itemCiteKey,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemTagContentStartDelim,
+	itemTagContent,
+	itemTagContentStopDelim,
+	itemEntryStopDelim,
+	itemEOF,
+}
+
+var passSet10 = []string{
+	`@preamble{ "\newcommand{\noopsort}[1]{}" # macro }`,
+	`@PREAMBLE{"\newcommand{\noopsort}[1]{}"#macro}`,
+}
+
+// expectedSet10 is the sequence of tokens expected for each entry in passSet10.
+var expectedSet10 = []itemType{
+	itemEntryTypeDelim,
+	itemEntryType,
+	itemEntryStartDelim,
+	itemQuoteDelim,
+	itemTagContent,
+	itemQuoteDelim,
+	itemConcat,
+	itemStringKey,
+	itemEntryStopDelim,
+	itemEOF,
+}
+
+var passSet11 = []string{
+	`@article(mycitekey1972,
+	author = {Hein Meling},
+	title = "The wonderful paper (revised)")`,
+	`@article ( mycitekey1972, author = {Hein Meling}, title = "The wonderful paper" )`,
+	`@article(mycitekey1972, author = {Hein Meling}, title = "The )wonderful( paper")`,
+}
+
+// expectedSet11 is the sequence of tokens expected for each entry in passSet11.
+var expectedSet11 = []itemType{
+	itemEntryTypeDelim,
+	itemEntryType,
+	itemEntryStartDelim,
+	itemCiteKey,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemTagContentStartDelim,
+	itemTagContent,
+	itemTagContentStopDelim,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemQuoteDelim,
+	itemTagContent,
+	itemQuoteDelim,
+	itemEntryStopDelim,
+	itemEOF,
+}
+
+var passSet12 = []string{
+	`@article{c72, year = 2020, volume = 12}`,
+	`@article{c72, year=2020 ,volume =  12   }`,
+}
+
+// expectedSet12 is the sequence of tokens expected for each entry in passSet12.
+var expectedSet12 = []itemType{
+	itemEntryTypeDelim,
+	itemEntryType,
+	itemEntryStartDelim,
+	itemCiteKey,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemNumber,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemNumber,
+	itemEntryStopDelim,
+	itemEOF,
+}
+
+var passSet13 = []string{
+	`@article{c72, author = gopher # pike, title = {T}}`,
+	`@article{c72,
+	author = gopher
+		# pike
+	,
+	title = {T}
+}`,
+	`@article{c72,author=gopher#pike,title={T}}`,
+	`@article(c72, author = gopher # pike, title = {T})`,
+}
+
+// expectedSet13 is the sequence of tokens expected for each entry in passSet13.
+var expectedSet13 = []itemType{
+	itemEntryTypeDelim,
+	itemEntryType,
+	itemEntryStartDelim,
+	itemCiteKey,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemStringKey,
+	itemConcat,
+	itemStringKey,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemTagContentStartDelim,
+	itemTagContent,
+	itemTagContentStopDelim,
+	itemEntryStopDelim,
+	itemEOF,
+}
+
+var passSet14 = []string{
+	`@article{c72, note = 12 # "a {"} b" # {c "d" e} # gopher, title = gopher}`,
+	`@article{c72, note = 12# "a {"} b"#{c "d" e}#gopher ,
+		title = gopher
+	}`,
+}
+
+// expectedSet14 is the sequence of tokens expected for each entry in passSet14.
+var expectedSet14 = []itemType{
+	itemEntryTypeDelim,
+	itemEntryType,
+	itemEntryStartDelim,
+	itemCiteKey,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemNumber,
+	itemConcat,
+	itemQuoteDelim,
+	itemTagContent,
+	itemQuoteDelim,
+	itemConcat,
+	itemTagContentStartDelim,
+	itemTagContent,
+	itemTagContentStopDelim,
+	itemConcat,
+	itemStringKey,
+	itemComma,
+	itemTagName,
+	itemEqual,
+	itemStringKey,
+	itemEntryStopDelim,
+	itemEOF,
+}
+
 var failSet = [...]string{
 	`@article{mycitekey1972,
 	aut  hor = {Hein Meling},
@@ -357,20 +535,28 @@ var failSet = [...]string{
   author = {Hein Meling},
   title = {The wonderful paper},
 }`,
+	`@comment{unbalanced {braces}`,
+	`@article(mycitekey1972, author = {Hein Meling}}`,
+	`@article{c72, year = 2020a}`,
+	`@article{c72, title = gopher pike}`,
+	`@article{c72, title = "unbalanced } brace"}`,
+	`@article{c72, title = gopher # }`,
+	`@article{c72, title = {x}, bogus }`,
+	`@article(c72, title = {x}, bogus)`,
 }
 
 func ExampleLexer() {
-	l := newLexer("bib", "@article{meling72, author = {Hein},}")
-	for it := l.nextItem(); it.typ != itemEOF; it = l.nextItem() {
-		fmt.Print(it, " ")
+	l := NewLexer("bib", "@article{meling72, author = {Hein},}")
+	for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+		fmt.Print(tok, " ")
 	}
 	// Output: "@" "article" "{" "meling72" "," "author" "=" "{" "Hein" "}" "," "}"
 }
 
-func ExampleFailingLexer() {
-	l := newLexer("bib", failSet[1])
-	for it := l.nextItem(); it.typ != itemEOF; it = l.nextItem() {
-		fmt.Print(it, " ")
+func ExampleLexer_failing() {
+	l := NewLexer("bib", failSet[1])
+	for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+		fmt.Print(tok, " ")
 	}
 	// Output: "@" "article" "{" unexpected character U+0077 'w' at line 1
 }
@@ -384,11 +570,99 @@ func TestLexer(t *testing.T) {
 	doTest(t, passSet6, expectedSet6)
 	doTest(t, passSet7, expectedSet7)
 	doTest(t, passSet8, expectedSet8)
+	doTest(t, passSet9, expectedSet9)
+	doTest(t, passSet10, expectedSet10)
+	doTest(t, passSet11, expectedSet11)
+	doTest(t, passSet12, expectedSet12)
+	doTest(t, passSet13, expectedSet13)
+	doTest(t, passSet14, expectedSet14)
+	doTest(t, passSet15, expectedSet15)
+}
+
+// passSet15 contains % comments between entries and between fields.
+// Between entries, a % starts a comment only at the start of a line.
+var passSet15 = []string{
+	`% @article{commented, out}
+@article{c72, % the key
+	title = {100% {Go}} % a comment
+	, % a line comment
+	author = gopher}`,
+	`% one
+@article{c72,%two
+title={100% {Go}}%three
+,%four
+author=gopher}`,
+	`  % one
+50% off @article{c72,%two
+title={100% {Go}}%three
+,%four
+author=gopher}`,
+}
+
+// expectedSet15 is the sequence of tokens expected for each entry in passSet15.
+var expectedSet15 = []itemType{
+	itemComment,
+	itemEntryTypeDelim,
+	itemEntryType,
+	itemEntryStartDelim,
+	itemCiteKey,
+	itemComma,
+	itemComment,
+	itemTagName,
+	itemEqual,
+	itemTagContentStartDelim,
+	itemTagContent,
+	itemTagContentStopDelim,
+	itemComment,
+	itemComma,
+	itemComment,
+	itemTagName,
+	itemEqual,
+	itemStringKey,
+	itemEntryStopDelim,
+	itemEOF,
+}
+
+func TestDropComments(t *testing.T) {
+	for _, input := range passSet15 {
+		l := NewLexer("bib", input, DropComments())
+		for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+			if tok.Kind == Comment || tok.Kind == Error {
+				t.Errorf("Got %s, expected no comments", tok)
+			}
+		}
+	}
+}
+
+// keySet contains cite keys and tag names accepted by BibTeX.
+var keySet = []string{"smith:2020", "doe-2019a", "foo_bar", "knuth+84", "Müller/2001", "a.b@c!d"}
+
+func TestKeyRunes(t *testing.T) {
+	for _, key := range keySet {
+		l := NewLexer("bib", "@article{"+key+", "+key+" = {x}}")
+		for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+			if (tok.Kind == CiteKey || tok.Kind == TagName) && tok.Val != key {
+				t.Errorf("Got %s, expected %q", tok, key)
+			}
+		}
+		if l.Err() != nil {
+			t.Errorf("Got %v, expected no error for %q", l.Err(), key)
+		}
+	}
+	strict := map[string]bool{"knuth+84": true, "a.b@c!d": true}
+	for _, key := range keySet {
+		l := NewLexer("bib", "@article{"+key+", title = {x}}", KeyRunes(IsStrictKeyRune))
+		for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+		}
+		if got := l.Err() != nil; got != strict[key] {
+			t.Errorf("Got error %v for %q, expected error: %t", l.Err(), key, strict[key])
+		}
+	}
 }
 
 func TestFailingLexer(t *testing.T) {
 	for i := 0; i < len(failSet); i++ {
-		l := newLexer("bib", failSet[i])
+		l := NewLexer("bib", failSet[i])
 		it := l.nextItem()
 		for it.typ != itemEOF && it.typ != itemError {
 			it = l.nextItem()
@@ -399,9 +673,116 @@ func TestFailingLexer(t *testing.T) {
 	}
 }
 
+func TestNextToken(t *testing.T) {
+	l := NewLexer("bib", passSet4[0])
+	for i := 0; i < len(expectedSet4); i++ {
+		tok := l.NextToken()
+		if tok.Kind != Kind(expectedSet4[i]) {
+			t.Errorf("Got %s, expected %s", tok.Kind, Kind(expectedSet4[i]))
+		}
+	}
+	if s := TagContentStartDelim.String(); s != "TagContentStartDelim" {
+		t.Errorf("Got %s, expected %s", s, "TagContentStartDelim")
+	}
+	if s := Kind(99).String(); s != "Kind(99)" {
+		t.Errorf("Got %s, expected %s", s, "Kind(99)")
+	}
+}
+
+func TestTokenPos(t *testing.T) {
+	input := "@article{key,\n  title = {T},\n}"
+	expected := []Pos{
+		{0, 1, 1, 1},    // @
+		{1, 1, 2, 8},    // article
+		{8, 1, 9, 9},    // {
+		{9, 1, 10, 12},  // key
+		{12, 1, 13, 13}, // ,
+		{16, 2, 3, 21},  // title
+		{22, 2, 9, 23},  // =
+		{24, 2, 11, 25}, // {
+		{25, 2, 12, 26}, // T
+		{26, 2, 13, 27}, // }
+		{27, 2, 14, 28}, // ,
+		{29, 3, 1, 30},  // }
+	}
+	l := NewLexer("bib", input)
+	for i := 0; i < len(expected); i++ {
+		tok := l.NextToken()
+		if tok.Pos != expected[i] {
+			t.Errorf("Got %+v for %s, expected %+v", tok.Pos, tok, expected[i])
+		}
+		if tok.Val != input[tok.Pos.Offset:tok.Pos.End] {
+			t.Errorf("Got %q, expected %q", input[tok.Pos.Offset:tok.Pos.End], tok.Val)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	l := NewLexer("bib", failSet[0])
+	for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+	}
+	var err *SyntaxError
+	if !errors.As(l.Err(), &err) {
+		t.Fatalf("Got %v, expected a *SyntaxError", l.Err())
+	}
+	if err.Rune != 'h' || err.State != StateTagName || err.Pos.Line != 2 || err.Pos.Column != 7 {
+		t.Errorf("Got %#U in %s at %s, expected %#U in %s at 2:7", err.Rune, err.State, err.Pos, 'h', StateTagName)
+	}
+	if len(err.Expected) != 3 || err.Expected[0] != TagName {
+		t.Errorf("Got %v, expected [TagName Equal EntryStopDelim]", err.Expected)
+	}
+	if l.NextToken().Kind != EOF || NewLexer("bib", passSet1[0]).Err() != nil {
+		t.Errorf("Expected EOF after error and no error before scanning")
+	}
+}
+
+func TestReaderLexer(t *testing.T) {
+	sets := [][]string{passSet1, passSet2, passSet3, passSet4, passSet5, passSet6, passSet7, passSet8, passSet9, passSet10, passSet11, passSet12, passSet13, passSet14, failSet[:],
+		{recoverInput, "@article{a, title = {x},\n  @article{b, title = {y}}\n@misc{c, title = {z}}\n"}}
+	for _, opts := range [][]Option{nil, {RecoverErrors()}, {RecoverErrors(), KeepTrivia()}} {
+		for _, set := range sets {
+			for _, input := range set {
+				sl := NewLexer("bib", input, opts...)
+				rl := NewReaderLexer("bib", iotest.OneByteReader(strings.NewReader(input)), opts...)
+				for {
+					want, got := sl.NextToken(), rl.NextToken()
+					if got != want {
+						t.Errorf("Got %s at %+v, expected %s at %+v", got, got.Pos, want, want.Pos)
+					}
+					if want.Kind == EOF || got.Kind == EOF {
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReaderLexerBoundedMemory(t *testing.T) {
+	const n = 10000
+	entry := "@article{key,\n\tauthor = {Hein Meling},\n\ttitle = {The wonderful paper},\n}\n"
+	l := NewReaderLexer("bib", strings.NewReader(strings.Repeat(entry, n)))
+	entries, maxBuf := 0, 0
+	for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+		if tok.Kind == Error {
+			t.Fatalf("Got %s, expected no error", tok)
+		}
+		if tok.Kind == EntryStopDelim {
+			entries++
+		}
+		maxBuf = max(maxBuf, len(l.input))
+	}
+	if entries != n {
+		t.Errorf("Got %d entries, expected %d", entries, n)
+	}
+	if maxBuf > 2*minRead {
+		t.Errorf("Got buffer of %d bytes, expected at most %d", maxBuf, 2*minRead)
+	}
+}
+
 func doTest(t *testing.T, passSet []string, expectedSet []itemType) {
 	for i := 0; i < len(passSet); i++ {
-		l := newLexer("bib", passSet[i])
+		l := NewLexer("bib", passSet[i])
 		for j := 0; j < len(expectedSet); j++ {
 			it := l.nextItem()
 			if it.typ != expectedSet[j] {
@@ -410,3 +791,271 @@ func doTest(t *testing.T, passSet []string, expectedSet []itemType) {
 		}
 	}
 }
+
+// recoverInput contains three malformed entries among good ones.
+var recoverInput = `@article{a1, title = {One}}
+@article{bad key, title = {Two}}
+@book{b2, title = {Three}}
+@misc{m3, title = {unterminated,
+  note = {an @ inside}
+@misc{m4, title = {Four}}
+@misc{m5, title = {Five} year = 2020}
+  @misc{m6, title = "Six"}
+`
+
+func TestRecoverErrors(t *testing.T) {
+	l := NewLexer("bib", recoverInput, RecoverErrors())
+	var keys []string
+	errs := 0
+	for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+		switch tok.Kind {
+		case CiteKey:
+			keys = append(keys, tok.Val)
+		case Error:
+			errs++
+		}
+	}
+	if got, expected := strings.Join(keys, " "), "a1 b2 m3 m4 m5 m6"; got != expected {
+		t.Errorf("Got keys %s, expected %s", got, expected)
+	}
+	var list ErrorList
+	if !errors.As(l.Err(), &list) || len(list) != 3 || errs != 3 {
+		t.Fatalf("Got %v and %d Error tokens, expected 3 errors", l.Err(), errs)
+	}
+	// the unclosed content of m3 ends at the @ of m4
+	for i, line := range []int{2, 4, 7} {
+		if list[i].Pos.Line != line {
+			t.Errorf("Got error at line %d, expected line %d", list[i].Pos.Line, line)
+		}
+	}
+	if !list[1].Unclosed || list[1].Rune != '{' || list[1].Pos.Column != 19 {
+		t.Errorf("Got %v at %s, expected the unclosed { at 4:19", list[1], list[1].Pos)
+	}
+	var serr *SyntaxError
+	if !errors.As(l.Err(), &serr) || serr != list[0] {
+		t.Errorf("Got %v, expected the first syntax error", serr)
+	}
+
+	// every byte of the input is kept when keeping trivia
+	l = NewLexer("bib", recoverInput, RecoverErrors(), KeepTrivia())
+	var sb strings.Builder
+	for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+		if tok.Kind != Error {
+			sb.WriteString(tok.Val)
+		}
+	}
+	if got := sb.String(); got != recoverInput {
+		t.Errorf("Got %q, expected %q", got, recoverInput)
+	}
+
+	// each unclosed brace is reported on its own line, in source order
+	l = NewLexer("bib", strings.Repeat("@misc{k, title = {stray {brace}\n", 100), RecoverErrors())
+	for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+	}
+	if !errors.As(l.Err(), &list) || len(list) != 100 {
+		t.Fatalf("Got %v, expected 100 errors", l.Err())
+	}
+	for i, err := range list {
+		if err.Pos.Line != i+1 || err.Pos.Column != 18 {
+			t.Errorf("Got error at %s, expected %d:18", err.Pos, i+1)
+			break
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	var kinds []itemType
+	for tok, err := range NewLexer("bib", passSet14[0]).Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, itemType(tok.Kind))
+	}
+	kinds = append(kinds, itemEOF)
+	if !slices.Equal(kinds, expectedSet14) {
+		t.Errorf("Got %v, expected %v", kinds, expectedSet14)
+	}
+	// the iteration stops at the first error
+	for tok, err := range NewLexer("bib", failSet[0]).Tokens() {
+		if tok.Kind == Error {
+			var serr *SyntaxError
+			if !errors.As(err, &serr) || serr.Pos != tok.Pos {
+				t.Errorf("Got %v, expected a *SyntaxError at %s", err, tok.Pos)
+			}
+		} else if err != nil {
+			t.Errorf("Got %v for %s, expected no error", err, tok)
+		}
+	}
+	// breaking out of the loop leaves the remaining tokens
+	l := NewLexer("bib", passSet14[0])
+	for range l.Tokens() {
+		break
+	}
+	if tok := l.NextToken(); tok.Kind != EntryType {
+		t.Errorf("Got %s, expected the entry type", tok)
+	}
+	// a reader error is yielded last
+	readErr := errors.New("read failed")
+	var last error
+	for _, err := range NewReaderLexer("bib", iotest.ErrReader(readErr)).Tokens() {
+		last = err
+	}
+	if last != readErr {
+		t.Errorf("Got %v, expected %v", last, readErr)
+	}
+}
+
+func TestBytesLexer(t *testing.T) {
+	for _, input := range append(passSet14, failSet[0]) {
+		data := []byte(input)
+		l, bl := NewLexer("bib", input), NewBytesLexer("bib", data)
+		for {
+			tok, btok := l.NextToken(), bl.NextBytesToken()
+			if btok.Kind != tok.Kind || string(btok.Val) != tok.Val || btok.Pos != tok.Pos {
+				t.Errorf("Got %s %q at %s, expected %s", btok.Kind, btok.Val, btok.Pos, tok)
+			}
+			if tok.Kind == Error || tok.Kind == EOF {
+				break
+			}
+			// the value aliases the input, up to its end
+			if len(btok.Val) > 0 && (&btok.Val[0] != &data[tok.Pos.Offset] || cap(btok.Val) != len(btok.Val)) {
+				t.Errorf("Got a copy of %s, expected a slice of the input", tok)
+			}
+		}
+	}
+}
+
+func TestInternNames(t *testing.T) {
+	in := NewInterner()
+	first := map[string]string{}
+	for _, input := range passSet14 {
+		l := NewLexer("bib", input, InternNames(in))
+		for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+			if tok.Kind != TagName && tok.Kind != EntryType {
+				continue
+			}
+			if s, ok := first[tok.Val]; !ok {
+				first[tok.Val] = tok.Val
+			} else if unsafe.StringData(s) != unsafe.StringData(tok.Val) {
+				t.Errorf("Got a new copy of %q, expected the interned string", tok.Val)
+			}
+			if unsafe.StringData(tok.Val) == unsafe.StringData(input[tok.Pos.Offset:]) {
+				t.Errorf("Got %q aliasing the input, expected a copy", tok.Val)
+			}
+		}
+	}
+	// article, note and title
+	if in.Len() != 3 {
+		t.Errorf("Got %d interned names, expected 3", in.Len())
+	}
+}
+
+func TestCopyValues(t *testing.T) {
+	for _, input := range passSet15 {
+		l := NewLexer("bib", input, CopyValues(), KeepTrivia())
+		for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+			if tok.Val != "" && unsafe.StringData(tok.Val) == unsafe.StringData(input[tok.Pos.Offset:]) {
+				t.Errorf("Got %s aliasing the input, expected a copy", tok)
+			}
+		}
+	}
+}
+
+// benchEntries are the entries repeated to build the benchmark corpus.
+var benchEntries = []string{
+	`@article{knuth%d,
+  author = {Donald E. Knuth and M{\"u}ller, J{\"u}rgen},
+  title = {The {Art} of Computer Programming, Volume %d},
+  journal = cacm,
+  year = 1968, month = oct,
+  pages = {1--%d},
+  doi = {10.1145/%d},
+}
+`,
+	`%% a comment before entry %d
+@inproceedings(pike%d, author = "Rob Pike" # " and " # "Ken Thompson",
+	booktitle = "Proceedings of the {USENIX} Conference",
+	note = {%d pages}, year = %d)
+`,
+	`@string{venue%d = "Journal of Things %d"}
+@misc{gopher%d, title = {Gophers}, howpublished = venue%d}
+`,
+}
+
+// benchCorpus returns the input for the benchmarks: the file named by
+// the environment variable BIBLEXER_BENCH_FILE, such as a large real
+// world bibliography, or else about 4 MB of generated entries.
+func benchCorpus(b *testing.B) string {
+	if name := os.Getenv("BIBLEXER_BENCH_FILE"); name != "" {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return string(data)
+	}
+	var sb strings.Builder
+	for i := 0; sb.Len() < 4<<20; i++ {
+		fmt.Fprintf(&sb, benchEntries[i%len(benchEntries)], i, i, i, i)
+	}
+	return sb.String()
+}
+
+// benchmarkLexer lexes the corpus with the lexers returned by newLexer,
+// and reports the throughput, and the time and allocations per token.
+func benchmarkLexer(b *testing.B, newLexer func(input string) *Lexer) {
+	input := benchCorpus(b)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	tokens := 0
+	for b.Loop() {
+		l := newLexer(input)
+		for tok := l.NextToken(); tok.Kind != EOF; tok = l.NextToken() {
+			tokens++
+		}
+		if err := l.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(tokens), "ns/token")
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(tokens), "allocs/token")
+}
+
+func BenchmarkLexer(b *testing.B) {
+	benchmarkLexer(b, func(input string) *Lexer {
+		return NewLexer("bench", input)
+	})
+}
+
+func BenchmarkReaderLexer(b *testing.B) {
+	benchmarkLexer(b, func(input string) *Lexer {
+		return NewReaderLexer("bench", strings.NewReader(input))
+	})
+}
+
+func BenchmarkBytesLexer(b *testing.B) {
+	in := NewInterner()
+	data := []byte(benchCorpus(b)) // the same corpus, converted outside the timing
+	benchmarkLexer(b, func(string) *Lexer {
+		return NewBytesLexer("bench", data, InternNames(in))
+	})
+}
+
+func BenchmarkLexerTrivia(b *testing.B) {
+	benchmarkLexer(b, func(input string) *Lexer {
+		return NewLexer("bench", input, KeepTrivia())
+	})
+}
+
+func BenchmarkParse(b *testing.B) {
+	input := benchCorpus(b)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Parse("bench", input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package biblexer
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// SyntaxTree is a concrete syntax tree of a BibTeX file. Unlike the
+// parse tree built by Parser, it keeps every token of the input,
+// including white space and the text between entries, so that it
+// reproduces the input byte for byte. Edits made through the methods
+// of the tree and its blocks change only the tokens they touch.
+type SyntaxTree struct {
+	Name   string
+	Blocks []*Block
+}
+
+// Block is a sequence of tokens: either an entry, from its entry type
+// delimiter to its entry stop delimiter, or the trivia between entries.
+// Tokens added by edits have zero positions.
+type Block struct {
+	Tokens []Token
+}
+
+// ParseSyntaxTree lexes the input string, keeping trivia, and returns
+// its concrete syntax tree. On error, the returned tree holds the
+// tokens lexed before the error.
+func ParseSyntaxTree(name, input string) (*SyntaxTree, error) {
+	l := NewLexer(name, input, KeepTrivia())
+	t := &SyntaxTree{Name: name}
+	var cur *Block
+	for {
+		tok := l.NextToken()
+		switch tok.Kind {
+		case EOF:
+			return t, nil
+		case Error:
+			return t, l.Err()
+		case EntryTypeDelim:
+			cur = &Block{}
+			t.Blocks = append(t.Blocks, cur)
+		default:
+			if cur == nil {
+				cur = &Block{}
+				t.Blocks = append(t.Blocks, cur)
+			}
+		}
+		cur.Tokens = append(cur.Tokens, tok)
+		if tok.Kind == EntryStopDelim {
+			cur = nil
+		}
+	}
+}
+
+// String returns the source text of the tree.
+func (t *SyntaxTree) String() string {
+	var sb strings.Builder
+	for _, b := range t.Blocks {
+		sb.WriteString(b.String())
+	}
+	return sb.String()
+}
+
+// WriteTo writes the source text of the tree to w.
+func (t *SyntaxTree) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, t.String())
+	return int64(n), err
+}
+
+// Entry returns the first entry block with the given key, compared
+// case-insensitively, or nil if there is none.
+func (t *SyntaxTree) Entry(key string) *Block {
+	for _, b := range t.Blocks {
+		if b.IsEntry() && strings.EqualFold(b.Key(), key) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Remove removes the block b from the tree, together with the white
+// space that follows it, and reports whether b was found.
+func (t *SyntaxTree) Remove(b *Block) bool {
+	for i, c := range t.Blocks {
+		if c != b {
+			continue
+		}
+		j := i + 1
+		if j < len(t.Blocks) && t.Blocks[j].isSpace() {
+			j++
+		}
+		t.Blocks = append(t.Blocks[:i], t.Blocks[j:]...)
+		return true
+	}
+	return false
+}
+
+// String returns the source text of the block.
+func (b *Block) String() string {
+	var sb strings.Builder
+	for _, tok := range b.Tokens {
+		sb.WriteString(tok.Val)
+	}
+	return sb.String()
+}
+
+// IsEntry reports whether the block is an entry, rather than trivia.
+func (b *Block) IsEntry() bool {
+	return len(b.Tokens) > 0 && b.Tokens[0].Kind == EntryTypeDelim
+}
+
+// isSpace reports whether the block holds only white space.
+func (b *Block) isSpace() bool {
+	for _, tok := range b.Tokens {
+		if tok.Kind != Space {
+			return false
+		}
+	}
+	return true
+}
+
+// Type returns the entry type of the block, or "" for trivia.
+func (b *Block) Type() string {
+	if i := b.find(0, EntryType); i >= 0 {
+		return b.Tokens[i].Val
+	}
+	return ""
+}
+
+// Key returns the cite key of an entry, or the name defined by an
+// @string entry, or "" if the block has no key.
+func (b *Block) Key() string {
+	if i := b.key(); i >= 0 {
+		return b.Tokens[i].Val
+	}
+	return ""
+}
+
+// SetKey replaces the key of the block. It returns an error if the
+// block has no key or the new key is not a valid key.
+func (b *Block) SetKey(key string) error {
+	i := b.key()
+	if i < 0 {
+		return fmt.Errorf("biblexer: %s block has no key", b.Type())
+	}
+	if !isKey(key) {
+		return fmt.Errorf("biblexer: invalid key %q", key)
+	}
+	b.Tokens[i].Val = key
+	return nil
+}
+
+// isKey reports whether s is a valid cite key or tag name.
+func isKey(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !IsKeyRune(r) }) < 0
+}
+
+// key returns the index of the key token, or -1.
+func (b *Block) key() int {
+	i := b.skipSpace(b.find(0, EntryStartDelim) + 1)
+	if i > 0 && i < len(b.Tokens) && (b.Tokens[i].Kind == CiteKey || b.Tokens[i].Kind == StringKey) {
+		return i
+	}
+	return -1
+}
+
+// Field returns the source text of the value of the named field,
+// compared case-insensitively, such as `{Knuth}` or `jan # "~1"`.
+func (b *Block) Field(name string) (string, bool) {
+	f, ok := b.field(name)
+	if !ok {
+		return "", false
+	}
+	var sb strings.Builder
+	for _, tok := range b.Tokens[f.start:f.end] {
+		sb.WriteString(tok.Val)
+	}
+	return sb.String(), true
+}
+
+// SetField sets the value of the named field to the braced text value,
+// leaving the rest of the entry untouched. A new field is added after
+// the last field, with the same layout. It returns an error if the name
+// is not a valid tag name.
+func (b *Block) SetField(name, value string) error {
+	if !b.IsEntry() || b.find(0, CiteKey) < 0 {
+		return fmt.Errorf("biblexer: %s block has no fields", b.Type())
+	}
+	if !isKey(name) {
+		return fmt.Errorf("biblexer: invalid field name %q", name)
+	}
+	if !balanced(value) {
+		return fmt.Errorf("biblexer: unbalanced braces in value %q", value)
+	}
+	val := []Token{{Kind: TagContentStartDelim, Val: "{"}, {Kind: TagContent, Val: value}, {Kind: TagContentStopDelim, Val: "}"}}
+	if f, ok := b.field(name); ok {
+		b.splice(f.start, f.end, val...)
+		return nil
+	}
+	// copy the layout of the last field, if any
+	indent := []Token{{Kind: Space, Val: "\n  "}}
+	equal := []Token{{Kind: Space, Val: " "}, {Kind: Equal, Val: "="}, {Kind: Space, Val: " "}}
+	fields := b.fields()
+	at := b.find(0, Comma) + 1 // after the cite key
+	if len(fields) > 0 {
+		last := fields[len(fields)-1]
+		indent = nil
+		if last.name > 0 && b.Tokens[last.name-1].Kind == Space {
+			indent = b.Tokens[last.name-1 : last.name]
+		}
+		equal = append([]Token(nil), b.Tokens[last.name+1:last.start]...)
+		at = last.comma + 1
+		if last.comma < 0 {
+			// no trailing comma: separate the new field by a comma
+			b.splice(last.end, last.end, Token{Kind: Comma, Val: ","})
+			at = last.end + 1
+		}
+	}
+	toks := append(slices.Clone(indent), Token{Kind: TagName, Val: name})
+	toks = append(toks, equal...)
+	toks = append(toks, val...)
+	if len(fields) > 0 && fields[len(fields)-1].comma >= 0 {
+		toks = append(toks, Token{Kind: Comma, Val: ","})
+	}
+	b.splice(at, at, toks...)
+	return nil
+}
+
+// DeleteField removes the named field, with its leading white space,
+// its comma and a comment on the rest of its line, and reports whether
+// the field was found.
+func (b *Block) DeleteField(name string) bool {
+	f, ok := b.field(name)
+	if !ok {
+		return false
+	}
+	start := f.name
+	if start > 0 && b.Tokens[start-1].Kind == Space {
+		start--
+	}
+	if f.comma >= 0 {
+		b.splice(start, b.lineComment(f.comma+1))
+		return true
+	}
+	// the last field without a trailing comma: remove the comma before
+	// it, unless that comma follows the cite key
+	if i := start - 1; i >= 0 && b.Tokens[i].Kind == Comma && b.find(0, TagName) < i {
+		start = i
+	}
+	b.splice(start, f.end)
+	return true
+}
+
+// fieldSpan holds the token indices of a field in a block.
+type fieldSpan struct {
+	name       int // index of the tag name
+	start, end int // range of the value, without surrounding space and comments
+	comma      int // index of the comma after the value, or -1
+}
+
+// fields returns the fields of the block in order.
+func (b *Block) fields() []fieldSpan {
+	var fields []fieldSpan
+	for i := b.find(0, TagName); i >= 0; i = b.find(i+1, TagName) {
+		f := fieldSpan{name: i, comma: -1}
+		f.start = b.skipSpace(b.find(i, Equal) + 1)
+		f.end = f.start
+		for f.end < len(b.Tokens) && b.Tokens[f.end].Kind != Comma && b.Tokens[f.end].Kind != EntryStopDelim {
+			f.end++
+		}
+		if f.end < len(b.Tokens) && b.Tokens[f.end].Kind == Comma {
+			f.comma = f.end
+		}
+		for f.end > f.start && (b.Tokens[f.end-1].Kind == Space || b.Tokens[f.end-1].Kind == Comment) {
+			f.end--
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// field returns the span of the named field.
+func (b *Block) field(name string) (fieldSpan, bool) {
+	for _, f := range b.fields() {
+		if strings.EqualFold(b.Tokens[f.name].Val, name) {
+			return f, true
+		}
+	}
+	return fieldSpan{}, false
+}
+
+// lineComment returns the index after a comment that follows index i
+// on the same line, or i if there is none.
+func (b *Block) lineComment(i int) int {
+	j := i
+	if j < len(b.Tokens) && b.Tokens[j].Kind == Space && !strings.Contains(b.Tokens[j].Val, "\n") {
+		j++
+	}
+	if j < len(b.Tokens) && b.Tokens[j].Kind == Comment {
+		return j + 1
+	}
+	return i
+}
+
+// find returns the index of the first token of kind k at or after i, or -1.
+func (b *Block) find(i int, k Kind) int {
+	for ; i < len(b.Tokens); i++ {
+		if b.Tokens[i].Kind == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// skipSpace returns the index of the first token at or after i that
+// is not white space.
+func (b *Block) skipSpace(i int) int {
+	for i < len(b.Tokens) && b.Tokens[i].Kind == Space {
+		i++
+	}
+	return i
+}
+
+// splice replaces the tokens in [i, j) with toks.
+func (b *Block) splice(i, j int, toks ...Token) {
+	b.Tokens = slices.Replace(b.Tokens, i, j, toks...)
+}
@@ -0,0 +1,117 @@
+package biblexer
+
+import (
+	"strings"
+	"testing"
+)
+
+var cstInput = `Junk before the first entry.
+@string{ gopher = "Mrs. Gopher" }
+
+@article{ c72 ,
+	author =gopher # "Mr. Pike", % reviewed
+  title = {The {Go} Paper}
+}
+@comment{ keep { this } }
+@book(k2,title="Second" # {Edition},)   trailing junk
+`
+
+func TestSyntaxTreeRoundTrip(t *testing.T) {
+	tree, err := ParseSyntaxTree("bib", cstInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.String(); got != cstInput {
+		t.Errorf("Got %q, expected %q", got, cstInput)
+	}
+	var sb strings.Builder
+	if _, err := tree.WriteTo(&sb); err != nil || sb.String() != cstInput {
+		t.Errorf("Got %q, %v, expected %q", sb.String(), err, cstInput)
+	}
+	// every byte of the input belongs to exactly one token
+	off := 0
+	for _, b := range tree.Blocks {
+		for _, tok := range b.Tokens {
+			if tok.Pos.Offset != off || tok.Pos.End != off+len(tok.Val) {
+				t.Errorf("Got %s at %d-%d, expected offset %d", tok, tok.Pos.Offset, tok.Pos.End, off)
+			}
+			off = tok.Pos.End
+		}
+	}
+	if tree.Blocks[0].Tokens[0].Kind != Junk {
+		t.Errorf("Got %s, expected Junk", tree.Blocks[0].Tokens[0].Kind)
+	}
+	if b := tree.Entry("C72"); b == nil || b.Type() != "article" {
+		t.Errorf("Got %v, expected article c72", b)
+	}
+	if b := tree.Entry("gopher"); b == nil || b.Type() != "string" {
+		t.Errorf("Got %v, expected string gopher", b)
+	}
+	if v, ok := tree.Entry("c72").Field("AUTHOR"); !ok || v != `gopher # "Mr. Pike"` {
+		t.Errorf("Got %q, expected %q", v, `gopher # "Mr. Pike"`)
+	}
+}
+
+func TestSyntaxTreeParse(t *testing.T) {
+	// the parser skips trivia
+	f, err := NewParser(NewLexer("bib", cstInput, KeepTrivia())).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Nodes) != 4 {
+		t.Errorf("Got %d nodes, expected 4", len(f.Nodes))
+	}
+}
+
+func TestSyntaxTreeEdit(t *testing.T) {
+	tree, err := ParseSyntaxTree("bib", cstInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c72, k2 := tree.Entry("c72"), tree.Entry("k2")
+	if err := c72.SetField("title", "A {Go} Paper"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c72.SetField("year", "1972"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k2.SetField("year", "2000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k2.SetKey("k3"); err != nil {
+		t.Fatal(err)
+	}
+	if !k2.DeleteField("title") || k2.DeleteField("title") {
+		t.Errorf("Got wrong result deleting title twice")
+	}
+	if err := c72.SetField("note", "unbalanced }"); err == nil {
+		t.Errorf("Got nil error, expected unbalanced braces")
+	}
+	for _, name := range []string{"", "bad name", "a=b"} {
+		if err := c72.SetField(name, "x"); err == nil {
+			t.Errorf("Got nil error, expected invalid field name %q", name)
+		}
+	}
+	if !tree.Remove(tree.Entry("gopher")) {
+		t.Errorf("Got false, expected @string gopher removed")
+	}
+	expected := `Junk before the first entry.
+@article{ c72 ,
+	author =gopher # "Mr. Pike", % reviewed
+  title = {A {Go} Paper},
+  year = {1972}
+}
+@comment{ keep { this } }
+@book(k3,year={2000},)   trailing junk
+`
+	if got := tree.String(); got != expected {
+		t.Errorf("Got %q, expected %q", got, expected)
+	}
+	if !c72.DeleteField("year") || !c72.DeleteField("author") {
+		t.Fatalf("Got false, expected fields deleted")
+	}
+	expected = "@article{ c72 ,\n  title = {A {Go} Paper}\n}"
+	if got := c72.String(); got != expected {
+		t.Errorf("Got %q, expected %q", got, expected)
+	}
+}
@@ -0,0 +1,443 @@
+package biblexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An EncodeOption configures an Encoder.
+type EncodeOption func(*Encoder)
+
+// TextDelim sets the delimiters used for text values; Braces or Quotes.
+// Text that cannot be enclosed in quotes, because it contains a quote
+// that is not enclosed in braces, is always enclosed in braces.
+// By default, text parsed from the input keeps its delimiters, and
+// values of an Entry are enclosed in braces.
+func TextDelim(d Delim) EncodeOption {
+	return func(e *Encoder) {
+		e.delim = &d
+	}
+}
+
+// FieldOrder sets the order of fields. The named fields are written
+// first in the given order, followed by the remaining fields in their
+// original order.
+func FieldOrder(names ...string) EncodeOption {
+	return func(e *Encoder) {
+		e.order = names
+	}
+}
+
+// Indent sets the indentation of fields. The default is two spaces.
+func Indent(indent string) EncodeOption {
+	return func(e *Encoder) {
+		e.indent = indent
+	}
+}
+
+// AlignEquals pads field names so that the = signs of an entry line up.
+func AlignEquals() EncodeOption {
+	return func(e *Encoder) {
+		e.align = true
+	}
+}
+
+// TrailingComma writes a comma after the last field of an entry.
+func TrailingComma() EncodeOption {
+	return func(e *Encoder) {
+		e.trailingComma = true
+	}
+}
+
+// Wrap wraps text values at white space so that lines do not exceed
+// width bytes, where possible. BibTeX treats the inserted line breaks
+// like the spaces they replace, but Parser keeps them in the expanded
+// values, so wrapping is lossy: values read back differ from the
+// original in their white space.
+func Wrap(width int) EncodeOption {
+	return func(e *Encoder) {
+		e.wrap = width
+	}
+}
+
+// EscapeUnicode writes the non-ASCII characters of text values as TeX,
+// such as {\"u} for ü, so that the output can be read by 8-bit BibTeX;
+// see EncodeTeX. If strict, encoding fails with an *UnmappableCharError
+// on characters that cannot be converted; otherwise they are written as is.
+func EscapeUnicode(strict bool) EncodeOption {
+	return func(e *Encoder) {
+		e.escape = true
+		e.strict = strict
+	}
+}
+
+// Encoder writes entries, @string definitions, @preamble and @comment
+// entries in BibTeX syntax to an output stream.
+type Encoder struct {
+	w             io.Writer
+	delim         *Delim   // the delimiters for text; nil to keep them
+	order         []string // the names of the fields to write first
+	indent        string   // the indentation of fields
+	align         bool     // whether to align the = signs of an entry
+	trailingComma bool     // whether to write a comma after the last field
+	wrap          int      // the maximum line width; 0 for no wrapping
+	escape        bool     // whether to write non-ASCII characters as TeX
+	strict        bool     // whether to fail on characters without TeX
+	buf           bytes.Buffer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer, opts ...EncodeOption) *Encoder {
+	e := &Encoder{w: w, indent: "  "}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Encode writes the nodes of the parse tree f, separated by blank lines.
+func (e *Encoder) Encode(f *FileNode) error {
+	for i, n := range f.Nodes {
+		if i > 0 {
+			e.buf.WriteString("\n")
+		}
+		if err := e.node(n); err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+// EncodeNode writes a single top-level node followed by a newline.
+func (e *Encoder) EncodeNode(n Node) error {
+	if err := e.node(n); err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+// EncodeEntry writes the entry followed by a newline. The values of its
+// fields are written as text, since their macros have been expanded.
+// An entry without a type is written as a misc entry.
+func (e *Encoder) EncodeEntry(entry *Entry) error {
+	typ := entry.Type
+	if typ == "" {
+		typ = "misc"
+	}
+	fields := make([]*FieldNode, 0, entry.Fields.Len())
+	for _, name := range entry.Fields.Names() {
+		value := entry.Fields.Get(name)
+		if !balanced(value) {
+			return fmt.Errorf("biblexer: unbalanced braces in field %s of entry %s", name, entry.Key)
+		}
+		text := &TextNode{NodeType: NodeText, Delim: Braces, Text: value}
+		fields = append(fields, &FieldNode{NodeType: NodeField, Name: name, Value: &ValueNode{NodeType: NodeValue, Parts: []Node{text}, Expanded: value}})
+	}
+	return e.EncodeNode(&EntryNode{NodeType: NodeEntry, EntryType: typ, Key: entry.Key, Fields: fields})
+}
+
+// flush writes the buffered output.
+func (e *Encoder) flush() error {
+	_, err := e.w.Write(e.buf.Bytes())
+	e.buf.Reset()
+	return err
+}
+
+// node buffers the node n followed by a newline.
+// On error, the buffer is left as it was.
+func (e *Encoder) node(n Node) error {
+	start := e.buf.Len()
+	if err := e.nodeBody(n); err != nil {
+		e.buf.Truncate(start)
+		return err
+	}
+	e.buf.WriteString("\n")
+	return nil
+}
+
+// nodeBody buffers the node n.
+func (e *Encoder) nodeBody(n Node) error {
+	switch n := n.(type) {
+	case *EntryNode:
+		return e.entry(n)
+	case *StringNode:
+		open, close := n.Delim.delims()
+		fmt.Fprintf(&e.buf, "@%s%s%s = ", n.EntryType, open, n.Key)
+		if err := e.value(n.Value, e.buf.Len()); err != nil {
+			return err
+		}
+		e.buf.WriteString(close)
+	case *PreambleNode:
+		open, close := n.Delim.delims()
+		fmt.Fprintf(&e.buf, "@%s%s", n.EntryType, open)
+		if n.Value != nil {
+			if err := e.value(n.Value, e.buf.Len()); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteString(close)
+	case *CommentNode:
+		e.buf.WriteString(n.String())
+	default:
+		return fmt.Errorf("biblexer: cannot encode %T", n)
+	}
+	return nil
+}
+
+// entry buffers the entry n.
+func (e *Encoder) entry(n *EntryNode) error {
+	open, close := n.Delim.delims()
+	fmt.Fprintf(&e.buf, "@%s%s%s,\n", n.EntryType, open, n.Key)
+	fields := e.sort(n.Fields)
+	width := 0
+	if e.align {
+		for _, f := range fields {
+			width = max(width, len(f.Name))
+		}
+	}
+	for i, f := range fields {
+		lineStart := e.buf.Len()
+		fmt.Fprintf(&e.buf, "%s%-*s = ", e.indent, width, f.Name)
+		if err := e.value(f.Value, lineStart); err != nil {
+			return err
+		}
+		if i < len(fields)-1 || e.trailingComma {
+			e.buf.WriteString(",")
+		}
+		e.buf.WriteString("\n")
+	}
+	e.buf.WriteString(close)
+	return nil
+}
+
+// sort returns the fields in the encoder's field order.
+func (e *Encoder) sort(fields []*FieldNode) []*FieldNode {
+	if len(e.order) == 0 {
+		return fields
+	}
+	rank := func(f *FieldNode) int {
+		for i, name := range e.order {
+			if strings.EqualFold(name, f.Name) {
+				return i
+			}
+		}
+		return len(e.order)
+	}
+	sorted := slices.Clone(fields)
+	slices.SortStableFunc(sorted, func(a, b *FieldNode) int {
+		return rank(a) - rank(b)
+	})
+	return sorted
+}
+
+// value buffers the value v; lineStart is the offset in the buffer
+// of the start of the current line.
+func (e *Encoder) value(v *ValueNode, lineStart int) error {
+	for i, part := range v.Parts {
+		if i > 0 {
+			e.buf.WriteString(" # ")
+		}
+		t, ok := part.(*TextNode)
+		if !ok {
+			e.buf.WriteString(part.String())
+			continue
+		}
+		text := t.Text
+		if e.escape {
+			var err error
+			if text, err = EncodeTeX(text); err != nil && e.strict {
+				return err
+			}
+		}
+		d := t.Delim
+		if e.delim != nil && (*e.delim == Braces || quotable(text)) {
+			d = *e.delim
+		}
+		open, close := d.delims()
+		e.buf.WriteString(open)
+		e.text(text, lineStart)
+		e.buf.WriteString(close)
+	}
+	return nil
+}
+
+// text buffers the text s, wrapping it at spaces if lines would
+// exceed the encoder's width. Continuation lines are indented twice.
+func (e *Encoder) text(s string, lineStart int) {
+	col := e.buf.Len() - lineStart
+	if e.wrap <= 0 || col+len(s) <= e.wrap || strings.Contains(s, "\n") {
+		e.buf.WriteString(s)
+		return
+	}
+	indent := e.indent + e.indent
+	for i, word := range strings.Split(s, " ") {
+		if i > 0 {
+			if col+1+len(word) > e.wrap && col > len(indent) {
+				e.buf.WriteString("\n" + indent)
+				col = len(indent)
+			} else {
+				e.buf.WriteString(" ")
+				col++
+			}
+		}
+		e.buf.WriteString(word)
+		col += len(word)
+	}
+}
+
+// quotable reports whether s can be enclosed in quotes,
+// that is, whether all its quotes are enclosed in braces.
+func quotable(s string) bool {
+	braces := 0
+	for _, r := range s {
+		switch {
+		case r == '{':
+			braces++
+		case r == '}':
+			braces--
+		case r == '"' && braces == 0:
+			return false
+		}
+	}
+	return true
+}
+
+// balanced reports whether the braces in s are balanced.
+func balanced(s string) bool {
+	braces := 0
+	for _, r := range s {
+		switch r {
+		case '{':
+			braces++
+		case '}':
+			if braces--; braces < 0 {
+				return false
+			}
+		}
+	}
+	return braces == 0
+}
+
+// Marshal returns the BibTeX encoding of v. The value v may be a
+// *FileNode, or an Entry, a struct with bibtex struct tags as described
+// for Unmarshal, a pointer to either, or a slice of any of these.
+// Structs without a ",type" field are written as @misc entries.
+func Marshal(v any, opts ...EncodeOption) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, opts...)
+	if f, ok := v.(*FileNode); ok {
+		err := enc.Encode(f)
+		return buf.Bytes(), err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		rv = reflect.ValueOf([]any{v})
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		entry, err := marshalEntry(rv.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		if err := enc.EncodeEntry(&entry); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalEntry returns the entry for the struct or Entry v.
+func marshalEntry(v reflect.Value) (Entry, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return Entry{}, errors.New("biblexer: cannot marshal nil entry")
+		}
+		v = v.Elem()
+	}
+	if v.Type() == entryType {
+		return v.Interface().(Entry), nil
+	}
+	if v.Kind() != reflect.Struct {
+		return Entry{}, fmt.Errorf("biblexer: cannot marshal Go value of type %s", v.Type())
+	}
+	entry := Entry{Type: "misc"}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, opt, ok := fieldTag(t.Field(i))
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		if (opt == "key" || opt == "type") && fv.Kind() != reflect.String {
+			return Entry{}, fmt.Errorf("biblexer: cannot marshal Go value of type %s as entry %s", fv.Type(), opt)
+		}
+		switch opt {
+		case "key":
+			entry.Key = fv.String()
+			continue
+		case "type":
+			if s := fv.String(); s != "" {
+				entry.Type = s
+			}
+			continue
+		}
+		s, err := marshalField(name, fv)
+		if err != nil {
+			return Entry{}, err
+		}
+		if s != "" {
+			entry.Fields.Set(name, s)
+		}
+	}
+	return entry, nil
+}
+
+// marshalField returns the value of the named field for v,
+// or the empty string if v is the zero value.
+func marshalField(name string, v reflect.Value) (string, error) {
+	switch {
+	case v.Type() == timeType:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(dateLayouts[0]), nil
+	case v.Type() == urlType:
+		u := v.Interface().(url.URL)
+		return u.String(), nil
+	case v.Kind() == reflect.Pointer && v.Type().Elem() == urlType:
+		if v.IsNil() {
+			return "", nil
+		}
+		return v.Interface().(*url.URL).String(), nil
+	case v.Kind() == reflect.String:
+		return v.String(), nil
+	case v.Type() == namesType:
+		return FormatNames(v.Interface().([]Name), VonLastFirst), nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		list := make([]string, v.Len())
+		for i := range list {
+			list[i] = v.Index(i).String()
+		}
+		if isNameList(name) {
+			return strings.Join(list, " and "), nil
+		}
+		return strings.Join(list, ", "), nil
+	case v.CanInt():
+		if v.IsZero() {
+			return "", nil
+		}
+		return strconv.FormatInt(v.Int(), 10), nil
+	}
+	return "", fmt.Errorf("biblexer: cannot marshal field %s of Go type %s", name, v.Type())
+}
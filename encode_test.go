@@ -0,0 +1,214 @@
+package biblexer
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var encodeInput = `@comment{jabref-meta: databaseType:bibtex;}
+@preamble{ "\newcommand{\noopsort}[1]{}" # gopher }
+@string{gopher = "Mrs. Gopher"}
+@article{c72,
+	author = gopher # " and Mr. Pike",
+	title = {The {"}Wonderful{"} Paper about lexing and parsing BibTeX files in Go},
+	year = 1972,
+	journal = "Journal of {Go}",
+}
+@book(k2, title = {Say "hi"})
+`
+
+func TestEncode(t *testing.T) {
+	f, err := Parse("bib", encodeInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+	want := `@comment{jabref-meta: databaseType:bibtex;}
+
+@preamble{"\newcommand{\noopsort}[1]{}" # gopher}
+
+@string{gopher = "Mrs. Gopher"}
+
+@article{c72,
+  author = gopher # " and Mr. Pike",
+  title = {The {"}Wonderful{"} Paper about lexing and parsing BibTeX files in Go},
+  year = 1972,
+  journal = "Journal of {Go}"
+}
+
+@book(k2,
+  title = {Say "hi"}
+)
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Got:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+	f, err := Parse("bib", encodeInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, TextDelim(Quotes), FieldOrder("year", "title"), Indent("\t"), AlignEquals(), TrailingComma(), Wrap(50))
+	if err := enc.EncodeNode(f.Nodes[3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.EncodeNode(f.Nodes[4]); err != nil {
+		t.Fatal(err)
+	}
+	want := `@article{c72,
+	year    = 1972,
+	title   = "The {"}Wonderful{"} Paper about lexing
+		and parsing BibTeX files in Go",
+	author  = gopher # " and Mr. Pike",
+	journal = "Journal of {Go}",
+}
+@book(k2,
+	title = {Say "hi"},
+)
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Got:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	options := []struct {
+		opts  []EncodeOption
+		lossy bool // whether the white space of values may change
+	}{
+		{nil, false},
+		{[]EncodeOption{TextDelim(Quotes), AlignEquals(), TrailingComma()}, false},
+		{[]EncodeOption{TextDelim(Braces), FieldOrder("title", "author"), Indent("    ")}, false},
+		{[]EncodeOption{Wrap(20)}, true},
+	}
+	f, err := Parse("bib", encodeInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range options {
+		out, err := Marshal(f, o.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := Parse("bib", string(out))
+		if err != nil {
+			t.Fatalf("Got %v for:\n%s", err, out)
+		}
+		if len(g.Nodes) != len(f.Nodes) {
+			t.Fatalf("Got %d nodes, expected %d", len(g.Nodes), len(f.Nodes))
+		}
+		for i := range f.Nodes {
+			if got, want := normalize(g.Nodes[i], o.lossy), normalize(f.Nodes[i], o.lossy); got != want {
+				t.Errorf("Got %s, expected %s", got, want)
+			}
+		}
+	}
+}
+
+// normalize returns the node's type, key and expanded values,
+// with fields sorted, and white space collapsed if collapse is set.
+func normalize(n Node, collapse bool) string {
+	var fields []string
+	switch n := n.(type) {
+	case *EntryNode:
+		fields = append(fields, n.EntryType, n.Key)
+		for _, f := range n.Fields {
+			v := f.Value.Expanded
+			if collapse {
+				v = strings.Join(strings.Fields(v), " ")
+			}
+			fields = append(fields, f.Name+"="+v)
+		}
+		slices.Sort(fields[2:])
+	case *StringNode:
+		fields = append(fields, n.Key, n.Value.Expanded)
+	case *PreambleNode:
+		fields = append(fields, n.Value.Expanded)
+	case *CommentNode:
+		fields = append(fields, n.Text)
+	}
+	return strings.Join(fields, "|")
+}
+
+func TestMarshal(t *testing.T) {
+	var papers []paper
+	if err := Unmarshal(unmarshalInput, &papers); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Marshal(papers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `@article{meling72,
+  author = {Hein Meling and {Barnes and Noble} and The Go Team},
+  title = {The wonderful paper},
+  date = {1972-10-01},
+  keywords = {go, bibtex, lexers},
+  url = {https://example.com/paper},
+  volume = {12}
+}
+
+@misc{k2,
+  title = {Second}
+}
+`
+	if string(out) != want {
+		t.Errorf("Got:\n%s\nexpected:\n%s", out, want)
+	}
+	var again []paper
+	if err := Unmarshal(out, &again); err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 2 || again[0].Title != papers[0].Title || !again[0].Date.Equal(papers[0].Date) || len(again[0].Authors) != 3 {
+		t.Errorf("Got %+v, expected %+v", again, papers)
+	}
+	if _, err := Marshal(Entry{Key: "k", Fields: fieldsOf("title", "unbalanced }")}); err == nil {
+		t.Errorf("Expected error for unbalanced braces")
+	}
+	if out, err := Marshal(Entry{Key: "k", Fields: fieldsOf("title", "T")}); err != nil || string(out) != "@misc{k,\n  title = {T}\n}\n" {
+		t.Errorf("Got %q (%v), expected a misc entry", out, err)
+	}
+	type intKey struct {
+		Key int `bibtex:",key"`
+	}
+	if _, err := Marshal(intKey{Key: 1}); err == nil {
+		t.Errorf("Expected error for an int key")
+	}
+}
+
+func fieldsOf(nameValues ...string) Fields {
+	var f Fields
+	for i := 0; i < len(nameValues); i += 2 {
+		f.Set(nameValues[i], nameValues[i+1])
+	}
+	return f
+}
+
+func TestEncodeEscapeUnicode(t *testing.T) {
+	f, err := Parse("bib", `@book{k, author = "Müller, Jürgen", title = {Go in 日本}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf, EscapeUnicode(false)).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+	want := "@book{k,\n  author = \"M{\\\"u}ller, J{\\\"u}rgen\",\n  title = {Go in 日本}\n}\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Got:\n%s\nexpected:\n%s", got, want)
+	}
+	buf.Reset()
+	var uerr *UnmappableCharError
+	if err := NewEncoder(&buf, EscapeUnicode(true)).Encode(f); !errors.As(err, &uerr) || buf.Len() != 0 {
+		t.Errorf("Got %v and %q, expected an unmappable character error and no output", err, buf.String())
+	}
+}
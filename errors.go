@@ -0,0 +1,87 @@
+package biblexer
+
+import "fmt"
+
+// State identifies the state the lexer was in when an error occurred.
+type State int
+
+const (
+	StateStart        State = iota // between entries
+	StateEntryType                 // scanning the entry type
+	StateCiteKey                   // scanning the cite key or @string key
+	StateTagName                   // scanning a tag name
+	StateContentStart              // scanning for the start of a tag's content
+	StateContent                   // scanning delimited tag content
+	StateTagDelim                  // scanning for the delimiter after a tag's content
+	StateComment                   // scanning the body of a @comment entry
+)
+
+var stateNames = [...]string{
+	StateStart:        "start",
+	StateEntryType:    "entry type",
+	StateCiteKey:      "cite key",
+	StateTagName:      "tag name",
+	StateContentStart: "content start",
+	StateContent:      "content",
+	StateTagDelim:     "tag delimiter",
+	StateComment:      "comment",
+}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", s)
+	}
+	return stateNames[s]
+}
+
+// SyntaxError describes an unexpected character or end of input
+// encountered by the Lexer.
+type SyntaxError struct {
+	Name     string // the name of the input
+	Pos      Pos    // the position of the offending rune or unclosed delimiter
+	Rune     rune   // the offending rune; -1 at end of input
+	State    State  // the lexer state in which the error occurred
+	Expected []Kind // the kinds of tokens that would have been accepted
+	Unclosed bool   // whether Rune is an opening delimiter that is never closed
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Unclosed {
+		return fmt.Sprintf("unclosed %#U at line %d", e.Rune, e.Pos.Line)
+	}
+	if e.Rune == eof {
+		return fmt.Sprintf("unexpected eof at line %d", e.Pos.Line)
+	}
+	return fmt.Sprintf("unexpected character %#U at line %d", e.Rune, e.Pos.Line)
+}
+
+// ErrorList is a list of syntax errors in the order of their positions.
+// It is returned when recovering from errors; see RecoverErrors.
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns an error equivalent to the list, or nil if it is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Unwrap returns the errors in the list, for errors.Is and errors.As.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, err := range l {
+		errs[i] = err
+	}
+	return errs
+}
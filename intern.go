@@ -0,0 +1,41 @@
+package biblexer
+
+import (
+	"strings"
+	"sync"
+)
+
+// Interner is a table of strings that returns one shared copy of each
+// distinct string. Lexers that share an Interner, see InternNames,
+// return tag names and entry types from the table, so that the names
+// repeated across entries and files are stored once. An Interner is
+// safe for concurrent use.
+type Interner struct {
+	mu      sync.Mutex
+	strings map[string]string
+}
+
+// NewInterner returns an empty interner.
+func NewInterner() *Interner {
+	return &Interner{strings: make(map[string]string)}
+}
+
+// Intern returns the string of the table equal to s, adding a copy of s
+// to the table if there is none.
+func (t *Interner) Intern(s string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v, ok := t.strings[s]; ok {
+		return v
+	}
+	s = strings.Clone(s)
+	t.strings[s] = s
+	return s
+}
+
+// Len returns the number of strings in the table.
+func (t *Interner) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.strings)
+}
@@ -4,9 +4,9 @@ package biblexer
 
 import "fmt"
 
-const _itemType_name = "itemErroritemEOFitemCommentitemEntryTypeDelimitemEntryTypeitemEntryStartDelimitemEntryStopDelimitemCiteKeyitemTagNameitemEqualitemTagContentitemTagDelimitemTagContentStartDelimitemTagContentStopDelimitemQuoteDelimitemConcatitemStringKey"
+const _itemType_name = "itemErroritemEOFitemCommentitemEntryTypeDelimitemEntryTypeitemEntryStartDelimitemEntryStopDelimitemCiteKeyitemTagNameitemEqualitemTagContentitemCommaitemTagContentStartDelimitemTagContentStopDelimitemQuoteDelimitemConcatitemStringKeyitemCommentEntryitemNumberitemSpaceitemJunk"
 
-var _itemType_index = [...]uint8{0, 9, 16, 27, 45, 58, 77, 95, 106, 117, 126, 140, 152, 176, 199, 213, 223, 236}
+var _itemType_index = [...]uint16{0, 9, 16, 27, 45, 58, 77, 95, 106, 117, 126, 140, 149, 173, 196, 210, 220, 233, 249, 259, 268, 276}
 
 func (i itemType) String() string {
 	if i < 0 || i >= itemType(len(_itemType_index)-1) {
@@ -2,95 +2,241 @@ package biblexer
 
 import (
 	"fmt"
+	"io"
+	"iter"
 	"strings"
 	"unicode"
 	"unicode/utf8"
+	"unsafe"
 )
 
 const eof = -1
 
+// minRead is the minimum number of bytes read from the input reader at a time.
+const minRead = 4096
+
 // stateFn represents the state of the scanner as a function that returns the next state.
-type stateFn func(*lexer) stateFn
+type stateFn func(*Lexer) stateFn
+
+// Pos describes the source range of a token.
+type Pos struct {
+	Offset int // byte offset of the start of the token, starting at 0.
+	Line   int // line number of the start of the token, starting at 1.
+	Column int // column number of the start of the token in bytes, starting at 1.
+	End    int // byte offset just past the end of the token.
+}
 
-// lexer holds the state of the scanner.
-type lexer struct {
-	name  string    // the name of the input; used only for error reports.
-	input string    // the string being scanned.
-	state stateFn   // the next lexing function to enter
-	pos   int       // current position in the input.
-	start int       // start position of this item.
-	skip  int       // number of rune's to skip (usually spaces)
-	width int       // width of last rune read from input.
-	items chan item // channel of scanned items.
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Lexer holds the state of the scanner.
+type Lexer struct {
+	name           string          // the name of the input; used only for error reports.
+	input          string          // the string being scanned.
+	bytes          []byte          // the input of a lexer created by NewBytesLexer, which input aliases.
+	rd             io.Reader       // the reader supplying more input; nil if the input is complete.
+	rerr           error           // the error returned by rd, if not io.EOF.
+	base           int             // offset of input[0] in the complete input.
+	state          stateFn         // the next lexing function to enter
+	pos            int             // current position in the input.
+	start          int             // start position of this item.
+	skip           int             // number of rune's to skip (usually spaces)
+	width          int             // width of last rune read from input.
+	line           int             // line number at pos.
+	lineStart      int             // offset of the first byte of the line at pos.
+	prevLineStart  int             // offset of the first byte of the line before pos.
+	startLine      int             // line number at start.
+	startLineStart int             // offset of the first byte of the line at start.
+	blank          bool            // whether only white space precedes pos on its line.
+	prevBlank      bool            // the value of blank before the last rune read.
+	startBlank     bool            // the value of blank at start.
+	entryStop      rune            // the delimiter that closes the current entry.
+	contentStop    rune            // the delimiter that closes the current string.
+	isKey          func(rune) bool // reports whether a rune may appear in a cite key or tag name.
+	trivia         bool            // whether to emit white space and text between entries.
+	dropComments   bool            // whether to ignore comments instead of emitting them.
+	recover        bool            // whether to resume the scan after an error.
+	intern         *Interner       // the table of tag names and entry types, if any.
+	copyValues     bool            // whether token values are copies rather than slices of the input.
+	errs           ErrorList       // the errors encountered so far, when recovering.
+	err            error           // the error of the most recent error item, if any.
+	items          []item          // scanned items not yet returned by nextItem.
+	head           int             // index of the next item to return.
+}
+
+// fill reads more input from the reader, dropping the input before start,
+// which has already been emitted or ignored. It reports whether any input
+// was added.
+func (l *Lexer) fill() bool {
+	if l.rd == nil {
+		return false
+	}
+	pending := l.input[l.start:]
+	buf := make([]byte, len(pending), len(pending)+max(minRead, len(pending)))
+	copy(buf, pending)
+	n, err := 0, error(nil)
+	for n == 0 && err == nil {
+		n, err = l.rd.Read(buf[len(pending):cap(buf)])
+	}
+	if err != nil {
+		l.rd = nil
+		if err != io.EOF {
+			l.rerr = err
+		}
+	}
+	// buf is never written again, so the input may alias it
+	l.input = unsafe.String(unsafe.SliceData(buf), len(pending)+n)
+	l.base += l.start
+	l.pos -= l.start
+	l.start = 0
+	return n > 0
 }
 
 // next returns the next rune in the input.
-func (l *lexer) next() (r rune) {
-	if l.pos >= len(l.input) {
-		l.width = 0
-		return eof
+func (l *Lexer) next() (r rune) {
+	l.prevBlank = l.blank
+	if l.pos < len(l.input) && l.input[l.pos] < utf8.RuneSelf {
+		// fast path for ASCII
+		r, l.width = rune(l.input[l.pos]), 1
+	} else {
+		for !utf8.FullRuneInString(l.input[l.pos:]) && l.fill() {
+		}
+		if l.pos >= len(l.input) {
+			l.width = 0
+			return eof
+		}
+		r, l.width = utf8.DecodeRuneInString(l.input[l.pos:])
 	}
-	r, l.width = utf8.DecodeRuneInString(l.input[l.pos:])
 	l.pos += l.width
+	if r == '\n' {
+		l.line++
+		l.prevLineStart = l.lineStart
+		l.lineStart = l.base + l.pos
+		l.blank = true
+	} else if !isSpace(r) {
+		l.blank = false
+	}
 	return r
 }
 
 // peek returns but does not consume the next rune in the input.
-func (l *lexer) peek() rune {
+func (l *Lexer) peek() rune {
 	r := l.next()
 	l.backup()
 	return r
 }
 
 // backup steps back one rune. Can only be called once per call of next.
-func (l *lexer) backup() {
+func (l *Lexer) backup() {
 	l.pos -= l.width
+	l.blank = l.prevBlank
+	if l.width == 1 && l.input[l.pos] == '\n' {
+		l.line--
+		l.lineStart = l.prevLineStart
+	}
 }
 
 // discard skips the current rune that may appear after an item.
 // Typically this will be to discard spaces after an item.
-func (l *lexer) discard() {
-	_, w := utf8.DecodeRuneInString(l.input[l.pos:])
+func (l *Lexer) discard() {
 	// add the width of the current rune to the skip count
-	l.skip += w
+	l.skip += l.width
 }
 
 // ignore skips over the pending input before this point.
-func (l *lexer) ignore() {
+func (l *Lexer) ignore() {
 	l.start = l.pos
+	l.startLine = l.line
+	l.startLineStart = l.lineStart
+	l.startBlank = l.blank
 }
 
-// ignoreSpaces skips over the remaining seqeunce of spaces.
-func (l *lexer) ignoreSpaces() {
+// ignoreSpaces skips over the remaining seqeunce of spaces and comments.
+func (l *Lexer) ignoreSpaces() {
 	for {
-		switch r := l.next(); {
-		case isSpace(r):
-			l.ignore()
-		default:
-			l.backup()
+		for isSpace(l.next()) {
+		}
+		l.backup()
+		l.ignoreTrivia(itemSpace)
+		if l.peek() != '%' {
 			return
 		}
+		l.lexComment()
+	}
+}
+
+// lexComment scans a comment from % up to, but not including, the end
+// of the line, and emits or ignores it.
+func (l *Lexer) lexComment() {
+	for r := l.next(); r != '\n' && r != eof; r = l.next() {
+	}
+	l.backup()
+	if l.dropComments && !l.trivia {
+		l.ignore()
+		return
+	}
+	l.emit(itemComment)
+}
+
+// ignoreTrivia skips over the pending input before this point, or
+// emits it as an item of type t when keeping trivia.
+func (l *Lexer) ignoreTrivia(t itemType) {
+	if l.trivia && l.pos > l.start {
+		l.emit(t)
+		return
 	}
+	l.ignore()
 }
 
 // emit passes an item back to the client.
-func (l *lexer) emit(t itemType) {
+func (l *Lexer) emit(t itemType) {
 	// backup pos if there are runes to skip
 	pos := l.pos - l.skip
-	l.items <- item{t, l.input[l.start:pos]}
-	l.start = l.pos
+	start := l.base + l.start
+	val := l.input[l.start:pos]
+	switch {
+	case l.intern != nil && (t == itemTagName || t == itemEntryType):
+		val = l.intern.Intern(val)
+	case l.copyValues:
+		val = strings.Clone(val)
+	}
+	l.items = append(l.items, item{
+		typ: t,
+		val: val,
+		pos: Pos{start, l.startLine, start - l.startLineStart + 1, l.base + pos},
+	})
+	if l.trivia && l.skip > 0 {
+		// the skipped runes follow the item on the same line
+		end := l.base + pos
+		l.items = append(l.items, item{
+			typ: itemSpace,
+			val: l.copy(l.input[pos:l.pos]),
+			pos: Pos{end, l.startLine, end - l.startLineStart + 1, l.base + l.pos},
+		})
+	}
+	l.ignore()
 	// reset the skip counter
 	l.skip = 0
 }
 
+// copy returns s, or a copy of s if the lexer copies token values.
+func (l *Lexer) copy(s string) string {
+	if l.copyValues {
+		return strings.Clone(s)
+	}
+	return s
+}
+
 // emit passes an item back to the client.
-func (l *lexer) emit1(t itemType) {
+func (l *Lexer) emit1(t itemType) {
 	l.pos++
+	l.blank = false // the delimiter is not white space
 	l.emit(t)
 }
 
 // accept consumes the next rune if it's from the valid set.
-func (l *lexer) accept(valid string) bool {
+func (l *Lexer) accept(valid string) bool {
 	if strings.IndexRune(valid, l.next()) >= 0 {
 		return true
 	}
@@ -99,25 +245,82 @@ func (l *lexer) accept(valid string) bool {
 }
 
 // acceptRun consumes a run of runes from the valid set.
-func (l *lexer) acceptRun(valid string) {
+func (l *Lexer) acceptRun(valid string) {
 	for strings.IndexRune(valid, l.next()) >= 0 {
 	}
 	l.backup()
 }
 
-// lineNumber reports which line we're on. Doing it this way
-// means we don't have to worry about peek double counting.
-func (l *lexer) lineNumber() int {
-	return 1 + strings.Count(l.input[:l.pos], "\n")
+// current returns the position of the last rune read by next.
+func (l *Lexer) current() Pos {
+	off := l.base + l.pos - l.width
+	return Pos{off, l.line, off - l.lineStart + 1, l.base + l.pos}
+}
+
+// errorf records a syntax error for the unexpected rune r, returns an
+// error token and terminates the scan by passing back a nil pointer
+// that will be the next state, terminating l.run. When recovering from
+// errors, the scan resumes at the next entry instead.
+func (l *Lexer) errorf(r rune, state State, expected ...Kind) stateFn {
+	return l.fail(&SyntaxError{
+		Name:     l.name,
+		Pos:      l.current(),
+		Rune:     r,
+		State:    state,
+		Expected: expected,
+	})
+}
+
+// unclosedf records a syntax error for the opening delimiter open,
+// which precedes start and is never closed, and returns the next state
+// like errorf.
+func (l *Lexer) unclosedf(open rune, state State, expected ...Kind) stateFn {
+	off := l.base + l.start - 1
+	return l.fail(&SyntaxError{
+		Name:     l.name,
+		Pos:      Pos{off, l.startLine, off - l.startLineStart + 1, off + 1},
+		Rune:     open,
+		State:    state,
+		Expected: expected,
+		Unclosed: true,
+	})
 }
 
-// error returns an error token and terminates the scan by passing
-// back a nil pointer that will be the next state, terminating l.run.
-func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{itemError, fmt.Sprintf(format, args...)}
+// fail emits an error item for err, and returns the next state.
+func (l *Lexer) fail(err *SyntaxError) stateFn {
+	l.err = err
+	l.items = append(l.items, item{itemError, err.Error(), err.Pos})
+	if l.recover {
+		l.errs = append(l.errs, err)
+		return lexRecover
+	}
 	return nil
 }
 
+// Err returns the error returned by the input reader, or else the
+// *SyntaxError that terminated the scan, or nil if no error has been
+// encountered. When recovering from errors, Err returns the ErrorList
+// of all syntax errors instead of the last one.
+func (l *Lexer) Err() error {
+	if l.rerr != nil {
+		return l.rerr
+	}
+	if l.recover {
+		return l.errs.Err()
+	}
+	return l.err
+}
+
+// lastErr returns the error of the most recent error item. Since the
+// lexer only runs when its items have been consumed, this is the error
+// of the last Error token returned by NextToken.
+func (l *Lexer) lastErr() error {
+	if l.rerr != nil {
+		return l.rerr
+	}
+	return l.err
+}
+
 // isSpace reports whether r is a space character.
 func isSpace(r rune) bool {
 	switch r {
@@ -135,32 +338,207 @@ func isAlphaNumeric(r rune) bool {
 // isUnbrokenAlphaNumericToken reports whether r is part of an unbroken
 // sequence of alphanumeric characters. Any call to discard prior to calling
 // isUnbrokenAlphaNumericToken will break the sequence; it will return false.
-func (l *lexer) isUnbrokenAlphaNumericToken(r rune) bool {
+func (l *Lexer) isUnbrokenAlphaNumericToken(r rune) bool {
 	return isAlphaNumeric(r) && l.skip == 0
 }
 
-// nextItem returns the next item from the input.
-func (l *lexer) nextItem() item {
-	for {
-		select {
-		case item := <-l.items:
-			return item
-		default:
-			if l.state == nil {
-				return item{itemEOF, ""}
+// IsKeyRune reports whether r may appear in a cite key or tag name.
+// BibTeX accepts any rune except white space and "#%'(),={}.
+func IsKeyRune(r rune) bool {
+	switch r {
+	case eof, '"', '#', '%', '\'', '(', ')', ',', '=', '{', '}':
+		return false
+	}
+	return !unicode.IsSpace(r)
+}
+
+// IsStrictKeyRune reports whether r is a letter, a digit, or one of
+// the punctuation runes "-_:./", which are portable across tools that
+// process cite keys, such as LaTeX packages and reference managers.
+func IsStrictKeyRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_:./", r)
+}
+
+// isUnbrokenKeyToken reports whether r is part of an unbroken sequence
+// of runes accepted in cite keys and tag names. Any call to discard prior
+// to calling isUnbrokenKeyToken will break the sequence; it will return false.
+func (l *Lexer) isUnbrokenKeyToken(r rune) bool {
+	return r != eof && l.isKey(r) && l.skip == 0
+}
+
+// nextItem returns the next item from the input. It runs the state
+// functions until they have emitted an item, and then returns the items
+// they emitted in order, before running them again.
+func (l *Lexer) nextItem() item {
+	for l.head == len(l.items) {
+		l.items, l.head = l.items[:0], 0
+		if l.state == nil {
+			off := l.base + l.pos
+			return item{itemEOF, "", Pos{off, l.line, off - l.lineStart + 1, off}}
+		}
+		l.state = l.state(l)
+	}
+	l.head++
+	return l.items[l.head-1]
+}
+
+// NextToken returns the next token from the input. Once the input is
+// exhausted, or after a token of kind Error, NextToken returns EOF tokens.
+func (l *Lexer) NextToken() Token {
+	it := l.nextItem()
+	return Token{Kind: Kind(it.typ), Val: it.val, Pos: it.pos}
+}
+
+// BytesToken is a token whose value is a byte slice.
+type BytesToken struct {
+	Kind Kind   // the kind of this token
+	Val  []byte // the token text; for Error tokens, the text of the error
+	Pos  Pos    // the source range of the token
+}
+
+// NextBytesToken returns the next token with its text as a byte slice.
+// For a lexer created by NewBytesLexer, the text aliases the input, even
+// for interned names, and its capacity ends with the token; otherwise,
+// and for Error tokens, it is a copy.
+func (l *Lexer) NextBytesToken() BytesToken {
+	tok := l.NextToken()
+	var val []byte
+	switch {
+	case tok.Kind == EOF:
+	case l.bytes != nil && tok.Kind != Error:
+		val = l.bytes[tok.Pos.Offset:tok.Pos.End:tok.Pos.End]
+	default:
+		val = []byte(tok.Val)
+	}
+	return BytesToken{Kind: tok.Kind, Val: val, Pos: tok.Pos}
+}
+
+// Tokens returns an iterator over the remaining tokens, up to but not
+// including the EOF token. Error tokens are yielded with their error;
+// the scan ends after an error, unless recovering from errors. If the
+// input reader fails, its error is yielded last, with the EOF token.
+func (l *Lexer) Tokens() iter.Seq2[Token, error] {
+	return func(yield func(Token, error) bool) {
+		for {
+			tok := l.NextToken()
+			switch tok.Kind {
+			case EOF:
+				if l.rerr != nil {
+					yield(tok, l.rerr)
+				}
+				return
+			case Error:
+				if !yield(tok, l.lastErr()) {
+					return
+				}
+			default:
+				if !yield(tok, nil) {
+					return
+				}
 			}
-			l.state = l.state(l)
 		}
 	}
 }
 
+// NewReaderLexer creates a new scanner for the input read from r.
+// Input is read in chunks as the scan progresses, and input that
+// precedes the current token is released, so that memory use is
+// bounded by the size of the largest token rather than the input.
+func NewReaderLexer(name string, r io.Reader, opts ...Option) *Lexer {
+	l := NewLexer(name, "", opts...)
+	l.rd = r
+	return l
+}
+
+// NewBytesLexer creates a new scanner for the input byte slice. The
+// input is not copied: the values of the tokens alias it, as strings
+// from NextToken and as byte slices from NextBytesToken, so it must not
+// be modified while the lexer or its tokens are in use.
+func NewBytesLexer(name string, input []byte, opts ...Option) *Lexer {
+	l := NewLexer(name, unsafe.String(unsafe.SliceData(input), len(input)), opts...)
+	l.bytes = input
+	return l
+}
+
+// An Option configures a Lexer.
+type Option func(*Lexer)
+
+// KeyRunes sets the function that reports whether a rune may appear in
+// cite keys and tag names. The default is IsKeyRune; IsStrictKeyRune
+// restricts keys to a more portable set.
+func KeyRunes(isKey func(rune) bool) Option {
+	return func(l *Lexer) {
+		l.isKey = isKey
+	}
+}
+
+// KeepTrivia makes the lexer emit the white space between tokens as
+// Space tokens and the text between entries as Junk tokens, so that
+// every byte of the input belongs to some token.
+func KeepTrivia() Option {
+	return func(l *Lexer) {
+		l.trivia = true
+	}
+}
+
+// DropComments makes the lexer ignore % comments instead of emitting
+// them as Comment tokens. It has no effect when keeping trivia.
+func DropComments() Option {
+	return func(l *Lexer) {
+		l.dropComments = true
+	}
+}
+
+// RecoverErrors makes the lexer resume the scan after a syntax error,
+// at the next @ that starts a line, outside the entry in error; only
+// white space may precede the @ on its line. Such an @ also ends a
+// braced or quoted value that is not closed before it, so that an
+// unbalanced brace costs only the entry it appears in. The tokens of the entry
+// in error up to the error, the Error token, and the tokens of the
+// following entries are all returned, and Err returns an ErrorList
+// of all errors. When keeping trivia, the skipped input is returned as
+// a Junk token.
+func RecoverErrors() Option {
+	return func(l *Lexer) {
+		l.recover = true
+	}
+}
+
+// InternNames makes the lexer return the values of TagName and EntryType
+// tokens from the table t, which may be shared by many lexers. Interned
+// names do not alias the input, but other values do, unless the lexer
+// also copies them; see CopyValues.
+func InternNames(t *Interner) Option {
+	return func(l *Lexer) {
+		l.intern = t
+	}
+}
+
+// CopyValues makes the lexer return token values that are copies rather
+// than slices of the input, so that tokens and the parse trees built
+// from them do not keep the input alive. With InternNames, tag names
+// and entry types are shared instead of copied.
+func CopyValues() Option {
+	return func(l *Lexer) {
+		l.copyValues = true
+	}
+}
+
 // NewLexer creates a new scanner for the input string.
-func newLexer(name, input string) *lexer {
-	l := &lexer{
-		name:  name,
-		input: input,
-		state: lexStart,
-		items: make(chan item, 2), // Two items sufficient.
+func NewLexer(name, input string, opts ...Option) *Lexer {
+	l := &Lexer{
+		name:       name,
+		input:      input,
+		state:      lexStart,
+		line:       1,
+		startLine:  1,
+		blank:      true,
+		startBlank: true,
+		isKey:      IsKeyRune,
+		items:      make([]item, 0, 8), // Grows if a state emits more items.
+	}
+	for _, opt := range opts {
+		opt(l)
 	}
 	return l
 }
@@ -0,0 +1,117 @@
+package biblexer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Diagnostic describes a problem that does not prevent parsing,
+// such as a reference to an undefined string macro.
+type Diagnostic struct {
+	Pos Pos    // the position of the problem
+	Msg string // a description of the problem
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Msg)
+}
+
+// macro is a string macro definition.
+type macro struct {
+	value   string // the expanded value
+	pos     Pos    // the position of the definition
+	builtin bool   // whether the macro comes from a MacroSet
+}
+
+// MacroTable holds string macros and expands references to them.
+// As in BibTeX, macro names are case-insensitive, and macros must be
+// defined before they are referenced.
+type MacroTable struct {
+	macros      map[string]macro
+	diagnostics []Diagnostic
+}
+
+// NewMacroTable returns an empty macro table.
+func NewMacroTable() *MacroTable {
+	return &MacroTable{macros: make(map[string]macro)}
+}
+
+// Define defines the macro name with the given expanded value. The position
+// is that of the definition; redefining a macro is reported as a diagnostic.
+func (t *MacroTable) Define(name, value string, pos Pos) {
+	key := strings.ToLower(name)
+	if m, ok := t.macros[key]; ok && !m.builtin {
+		t.diagnose(pos, "macro %q redefined; previous definition at %s", name, m.pos)
+	}
+	t.macros[key] = macro{value: value, pos: pos}
+}
+
+// Enable defines the macros in the given sets. Like the macros predefined
+// by BibTeX styles, they may be redefined without a diagnostic.
+func (t *MacroTable) Enable(sets ...MacroSet) {
+	for _, set := range sets {
+		for name, value := range set {
+			t.macros[strings.ToLower(name)] = macro{value: value, builtin: true}
+		}
+	}
+}
+
+// Load defines the macros of the @string entries read from r.
+// The input may contain @comment entries, but no other entries.
+func (t *MacroTable) Load(name string, r io.Reader) error {
+	p := &Parser{lex: NewReaderLexer(name, r), macros: t}
+	for {
+		n, err := p.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch n := n.(type) {
+		case *StringNode, *CommentNode:
+		case *EntryNode:
+			return fmt.Errorf("%s:%s: unexpected @%s entry in macro file", name, n.Pos, n.EntryType)
+		case *PreambleNode:
+			return fmt.Errorf("%s:%s: unexpected @%s entry in macro file", name, n.Pos, n.EntryType)
+		}
+	}
+}
+
+// Lookup returns the value of the macro name, and whether it is defined.
+func (t *MacroTable) Lookup(name string) (string, bool) {
+	m, ok := t.macros[strings.ToLower(name)]
+	return m.value, ok
+}
+
+// Expand returns the value of v with its parts concatenated and macro
+// references replaced by their values. An undefined macro expands to
+// the empty string and is reported as a diagnostic.
+func (t *MacroTable) Expand(v *ValueNode) string {
+	var sb strings.Builder
+	for _, part := range v.Parts {
+		switch part := part.(type) {
+		case *TextNode:
+			sb.WriteString(part.Text)
+		case *NumberNode:
+			sb.WriteString(part.Text)
+		case *MacroNode:
+			value, ok := t.Lookup(part.Name)
+			if !ok {
+				t.diagnose(part.Pos, "undefined macro %q", part.Name)
+			}
+			sb.WriteString(value)
+		}
+	}
+	return sb.String()
+}
+
+// Diagnostics returns the problems found while defining and expanding macros.
+func (t *MacroTable) Diagnostics() []Diagnostic {
+	return t.diagnostics
+}
+
+func (t *MacroTable) diagnose(pos Pos, format string, args ...interface{}) {
+	t.diagnostics = append(t.diagnostics, Diagnostic{pos, fmt.Sprintf(format, args...)})
+}
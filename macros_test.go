@@ -0,0 +1,112 @@
+package biblexer
+
+import (
+	"strings"
+	"testing"
+)
+
+var macroInput = `@string{gopher = "Mrs. Gopher"}
+@string{both = Gopher # " and " # pike}
+@string{pike = "Mr. Pike"}
+@article{c72,
+	author = gopher # " and " # pike,
+	editor = both,
+	year = 19 # 72,
+}
+@string{gopher = "Dr. Gopher"}
+@misc{m1, author = gopher}
+`
+
+func TestMacroExpansion(t *testing.T) {
+	f, err := Parse("bib", macroInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	article := f.Nodes[3].(*EntryNode)
+	expected := map[string]string{
+		"author": "Mrs. Gopher and Mr. Pike",
+		"editor": "Mrs. Gopher and ", // pike is not yet defined when both is defined
+		"year":   "1972",
+	}
+	for name, want := range expected {
+		if got := article.Field(name).Value.Expanded; got != want {
+			t.Errorf("Got %q for %s, expected %q", got, name, want)
+		}
+	}
+	// the unexpanded form is kept for writing
+	if got := article.Field("author").Value.String(); got != `gopher # " and " # pike` {
+		t.Errorf("Got %s, expected %s", got, `gopher # " and " # pike`)
+	}
+	misc := f.Nodes[5].(*EntryNode)
+	if got := misc.Field("author").Value.Expanded; got != "Dr. Gopher" {
+		t.Errorf("Got %q, expected %q", got, "Dr. Gopher")
+	}
+
+	diags := f.Macros.Diagnostics()
+	if len(diags) != 2 {
+		t.Fatalf("Got %v, expected 2 diagnostics", diags)
+	}
+	if !strings.Contains(diags[0].Msg, "undefined macro \"pike\"") || diags[0].Pos.Line != 2 {
+		t.Errorf("Got %s, expected undefined macro at line 2", diags[0])
+	}
+	if !strings.Contains(diags[1].Msg, "redefined") || diags[1].Pos.Line != 9 {
+		t.Errorf("Got %s, expected redefined macro at line 9", diags[1])
+	}
+}
+
+func TestMacroTable(t *testing.T) {
+	p := NewParser(NewLexer("bib", `@misc{m1, note = SIAM # " Journal"}`))
+	p.Macros().Define("siam", "Society for Industrial and Applied Mathematics", Pos{})
+	f, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Society for Industrial and Applied Mathematics Journal"
+	if got := f.Nodes[0].(*EntryNode).Field("note").Value.Expanded; got != want {
+		t.Errorf("Got %q, expected %q", got, want)
+	}
+	if v, ok := f.Macros.Lookup("Siam"); !ok || v != want[:len(v)] {
+		t.Errorf("Got %q, expected case-insensitive lookup", v)
+	}
+}
+
+func TestMacroSets(t *testing.T) {
+	p := NewParser(NewLexer("bib", `@string{oct = "Oct."}
+@article{c72, journal = cacm, month = oct, note = tcs # ", " # aug}`))
+	p.Macros().Enable(MonthMacros, JournalMacros)
+	f, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := f.Nodes[1].(*EntryNode)
+	expected := map[string]string{
+		"journal": "Communications of the ACM",
+		"month":   "Oct.",
+		"note":    "Theoretical Computer Science, August",
+	}
+	for name, want := range expected {
+		if got := e.Field(name).Value.Expanded; got != want {
+			t.Errorf("Got %q for %s, expected %q", got, name, want)
+		}
+	}
+	if diags := f.Macros.Diagnostics(); len(diags) != 0 {
+		t.Errorf("Got %v, expected no diagnostics when redefining built-in macros", diags)
+	}
+}
+
+func TestMacroLoad(t *testing.T) {
+	macros := NewMacroTable()
+	err := macros.Load("macros.bib", strings.NewReader(`@comment{journal abbreviations}
+@string{jgo = "Journal of Go"}
+@string(jgoe = jgo # " Errata")`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := macros.Lookup("jgoe"); !ok || v != "Journal of Go Errata" {
+		t.Errorf("Got %q, expected %q", v, "Journal of Go Errata")
+	}
+	err = macros.Load("bad.bib", strings.NewReader(`@string{a = "b"} @misc{m1, note = a}`))
+	if err == nil || !strings.Contains(err.Error(), "bad.bib:1:18") {
+		t.Errorf("Got %v, expected error for @misc entry at bad.bib:1:18", err)
+	}
+}
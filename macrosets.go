@@ -0,0 +1,46 @@
+package biblexer
+
+// A MacroSet holds predefined string macros, keyed by name.
+type MacroSet map[string]string
+
+// MonthMacros holds the month abbreviations predefined
+// by the standard BibTeX styles, such as month = oct.
+var MonthMacros = MacroSet{
+	"jan": "January",
+	"feb": "February",
+	"mar": "March",
+	"apr": "April",
+	"may": "May",
+	"jun": "June",
+	"jul": "July",
+	"aug": "August",
+	"sep": "September",
+	"oct": "October",
+	"nov": "November",
+	"dec": "December",
+}
+
+// JournalMacros holds the journal abbreviations predefined
+// by the standard BibTeX styles, such as journal = cacm.
+var JournalMacros = MacroSet{
+	"acmcs":    "ACM Computing Surveys",
+	"acta":     "Acta Informatica",
+	"cacm":     "Communications of the ACM",
+	"ibmjrd":   "IBM Journal of Research and Development",
+	"ibmsj":    "IBM Systems Journal",
+	"ieeese":   "IEEE Transactions on Software Engineering",
+	"ieeetc":   "IEEE Transactions on Computers",
+	"ieeetcad": "IEEE Transactions on Computer-Aided Design of Integrated Circuits",
+	"ipl":      "Information Processing Letters",
+	"jacm":     "Journal of the ACM",
+	"jcss":     "Journal of Computer and System Sciences",
+	"scp":      "Science of Computer Programming",
+	"sicomp":   "SIAM Journal on Computing",
+	"tocs":     "ACM Transactions on Computer Systems",
+	"tods":     "ACM Transactions on Database Systems",
+	"tog":      "ACM Transactions on Graphics",
+	"toms":     "ACM Transactions on Mathematical Software",
+	"toois":    "ACM Transactions on Office Information Systems",
+	"toplas":   "ACM Transactions on Programming Languages and Systems",
+	"tcs":      "Theoretical Computer Science",
+}
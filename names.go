@@ -0,0 +1,265 @@
+package biblexer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Name is a personal name split into its four parts, following the
+// rules of BibTeX. The parts keep their braces and the ties and
+// hyphens between their words; white space is reduced to one space.
+type Name struct {
+	First string // the first names, e.g. "Jean-Paul"
+	Von   string // the lower case particles, e.g. "de la"
+	Last  string // the last names, e.g. "Fontaine"
+	Jr    string // the suffix, e.g. "Jr."
+}
+
+// NameFormat identifies one of the forms in which BibTeX accepts names.
+type NameFormat int
+
+const (
+	FirstVonLast   NameFormat = iota // "First von Last"
+	VonLastFirst                     // "von Last, First"
+	VonLastJrFirst                   // "von Last, Jr, First"
+)
+
+// ParseNames parses a list of names separated by "and", such as the
+// value of an author or editor field. The name "others", which stands
+// for further unnamed authors, is returned as a name with only a last
+// part; see Name.IsOthers.
+func ParseNames(s string) []Name {
+	var names []Name
+	for _, name := range splitNames(s) {
+		names = append(names, ParseName(name))
+	}
+	return names
+}
+
+// ParseName parses a single name in any of the BibTeX forms. Words are
+// separated by white space, ties and hyphens, and parts by commas, all
+// outside braces; so "{Barnes and Noble}" is a single last name. In the
+// forms with commas, the von part is the longest sequence of words that
+// starts with a lower case word and ends with one, leaving at least one
+// word for the last part. In the form without commas, the first part
+// is the sequence of upper case words before the von part, and the
+// last part is the last word if there is no von part.
+func ParseName(s string) Name {
+	parts := nameParts(s)
+	var n Name
+	switch len(parts) {
+	case 0:
+		return n
+	case 1:
+		words := parts[0]
+		last := len(words) - 1
+		start, end := -1, -1 // the von part, if start >= 0
+		for i, w := range words[:last] {
+			if isVonWord(w.text) {
+				if start < 0 {
+					start = i
+				}
+				end = i + 1
+			}
+		}
+		if start < 0 {
+			n.First = joinWords(words[:last])
+			n.Last = joinWords(words[last:])
+			return n
+		}
+		n.First = joinWords(words[:start])
+		n.Von = joinWords(words[start:end])
+		n.Last = joinWords(words[end:])
+		return n
+	case 2:
+		n.First = joinWords(parts[1])
+	default:
+		n.Jr = joinWords(parts[1])
+		// extra commas are taken as part of the first names
+		var first []nameWord
+		for i, p := range parts[2:] {
+			if i > 0 && len(first) > 0 {
+				first[len(first)-1].sep = ", "
+			}
+			first = append(first, p...)
+		}
+		n.First = joinWords(first)
+	}
+	words := parts[0]
+	end := 0
+	for i, w := range words[:max(len(words)-1, 0)] {
+		if isVonWord(w.text) {
+			end = i + 1
+		}
+	}
+	n.Von = joinWords(words[:end])
+	n.Last = joinWords(words[end:])
+	return n
+}
+
+// IsOthers reports whether n is the name "others".
+func (n Name) IsOthers() bool {
+	return n == Name{Last: "others"}
+}
+
+// Format returns the name in the form f. Neither FirstVonLast nor
+// VonLastFirst can express a Jr part, so names with a Jr part are always
+// formatted as VonLastJrFirst, with all three parts, so that the Jr part
+// is not read back as the first part. Other parts that are empty are
+// left out.
+func (n Name) Format(f NameFormat) string {
+	last := joinParts(" ", n.Von, n.Last)
+	switch {
+	case n.Jr != "":
+		return last + ", " + n.Jr + ", " + n.First
+	case f == FirstVonLast:
+		return joinParts(" ", n.First, last)
+	}
+	return joinParts(", ", last, n.First)
+}
+
+// String returns the name in the form "von Last, First", or in the
+// form "von Last, Jr, First" if the name has a Jr part.
+func (n Name) String() string {
+	return n.Format(VonLastFirst)
+}
+
+// FormatNames returns the names in the form f, separated by "and".
+func FormatNames(names []Name, f NameFormat) string {
+	list := make([]string, len(names))
+	for i, n := range names {
+		list[i] = n.Format(f)
+	}
+	return strings.Join(list, " and ")
+}
+
+// nameWord is a word of a name and the separator that follows it.
+type nameWord struct {
+	text string
+	sep  string // " ", "~" or "-"
+}
+
+// nameParts splits a name into its comma separated parts, and each
+// part into words.
+func nameParts(s string) [][]nameWord {
+	var parts [][]nameWord
+	var words []nameWord
+	braces, start := 0, 0
+	word := func(i int) {
+		if start < i {
+			words = append(words, nameWord{s[start:i], " "})
+		}
+		start = i + 1
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '{':
+			braces++
+		case c == '}' && braces > 0:
+			braces--
+		case braces > 0:
+		case c == ',':
+			word(i)
+			parts = append(parts, words)
+			words = nil
+		case isSpace(rune(c)) || c == '~' || c == '-':
+			word(i)
+			if n := len(words); n > 0 && (c == '~' || c == '-') {
+				words[n-1].sep = string(c)
+			}
+		}
+	}
+	word(len(s))
+	if words != nil || parts != nil {
+		parts = append(parts, words)
+	}
+	return parts
+}
+
+// joinWords joins words with their separators.
+func joinWords(words []nameWord) string {
+	var sb strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			sb.WriteString(words[i-1].sep)
+		}
+		sb.WriteString(w.text)
+	}
+	return sb.String()
+}
+
+// joinParts joins the parts that are not empty with sep.
+func joinParts(sep string, parts ...string) string {
+	var list []string
+	for _, p := range parts {
+		if p != "" {
+			list = append(list, p)
+		}
+	}
+	return strings.Join(list, sep)
+}
+
+// isVonWord reports whether the word w starts with a lower case letter,
+// as BibTeX decides it: letters in braces do not count, except in
+// special characters such as {\"u} or {\ae}, which count as the letter
+// they stand for. Words without such letters are not von words.
+func isVonWord(w string) bool {
+	braces := 0
+	for i, r := range w {
+		switch {
+		case r == '{':
+			if braces == 0 && strings.HasPrefix(w[i+1:], `\`) {
+				return isLowerSpecial(w[i+1:])
+			}
+			braces++
+		case r == '}':
+			braces--
+		case braces == 0 && unicode.IsLetter(r):
+			return unicode.IsLower(r)
+		}
+	}
+	return false
+}
+
+// isLowerSpecial reports whether the special character s, which starts
+// with a control sequence and ends at the closing brace, is lower case.
+func isLowerSpecial(s string) bool {
+	cs := controlSequence(s)
+	switch cs {
+	case `\OE`, `\AE`, `\AA`, `\O`, `\L`:
+		return false
+	case `\oe`, `\ae`, `\aa`, `\o`, `\l`, `\ss`, `\i`, `\j`:
+		return true
+	}
+	s = s[len(cs):]
+	for i := 0; i < len(s); {
+		if s[i] == '}' {
+			break
+		}
+		if s[i] == '\\' {
+			i += len(controlSequence(s[i:]))
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if unicode.IsLetter(r) {
+			return unicode.IsLower(r)
+		}
+		i += n
+	}
+	return false
+}
+
+// controlSequence returns the TeX control sequence at the start of s,
+// which is a backslash followed by a run of letters or a single rune.
+func controlSequence(s string) string {
+	i := 1
+	for i < len(s) && isLetter(s[i]) {
+		i++
+	}
+	if i == 1 && i < len(s) {
+		_, n := utf8.DecodeRuneInString(s[i:])
+		i += n
+	}
+	return s[:i]
+}
@@ -0,0 +1,88 @@
+package biblexer
+
+import "testing"
+
+// nameSet maps names to their parts, as BibTeX splits them.
+var nameSet = []struct {
+	input string
+	name  Name
+}{
+	{"Donald E. Knuth", Name{First: "Donald E.", Last: "Knuth"}},
+	{"Knuth", Name{Last: "Knuth"}},
+	{"Ludwig van Beethoven", Name{First: "Ludwig", Von: "van", Last: "Beethoven"}},
+	{"Jean de la Fontaine", Name{First: "Jean", Von: "de la", Last: "Fontaine"}},
+	{"de la Fontaine, Jean", Name{First: "Jean", Von: "de la", Last: "Fontaine"}},
+	{"de la fontaine", Name{Von: "de la", Last: "fontaine"}},
+	{"Ford, Jr., Henry", Name{First: "Henry", Von: "", Last: "Ford", Jr: "Jr."}},
+	{"van der Meer, III, Jan  Pieter", Name{First: "Jan Pieter", Von: "van der", Last: "Meer", Jr: "III"}},
+	{"Jean-Paul Sartre", Name{First: "Jean-Paul", Last: "Sartre"}},
+	{"Jean-paul Sartre", Name{First: "Jean", Von: "paul", Last: "Sartre"}},
+	{"J.~R.~R. Tolkien", Name{First: "J.~R.~R.", Last: "Tolkien"}},
+	{"{Barnes and Noble}", Name{Last: "{Barnes and Noble}"}},
+	{"{Barnes and Noble, Inc.}", Name{Last: "{Barnes and Noble, Inc.}"}},
+	{"Charles Louis Xavier Joseph de la Vall{\\'e}e Poussin", Name{First: "Charles Louis Xavier Joseph", Von: "de la", Last: "Vall{\\'e}e Poussin"}},
+	{"{\\'E}mile Zola", Name{First: "{\\'E}mile", Last: "Zola"}},
+	{"{\\'e}mile Zola", Name{Von: "{\\'e}mile", Last: "Zola"}},
+	{"{von} Neumann, John", Name{First: "John", Last: "{von} Neumann"}},
+	{"{\\ae}rø Jensen", Name{Von: "{\\ae}rø", Last: "Jensen"}},
+	{"others", Name{Last: "others"}},
+	{"", Name{}},
+}
+
+func TestParseName(t *testing.T) {
+	for _, test := range nameSet {
+		if got := ParseName(test.input); got != test.name {
+			t.Errorf("Got %#v, expected %#v for %q", got, test.name, test.input)
+		}
+	}
+}
+
+func TestParseNames(t *testing.T) {
+	names := ParseNames("Hein Meling AND {Barnes and Noble} and de Gopher, Mrs. and others")
+	expected := []Name{
+		{First: "Hein", Last: "Meling"},
+		{Last: "{Barnes and Noble}"},
+		{First: "Mrs.", Von: "de", Last: "Gopher"},
+		{Last: "others"},
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("Got %v, expected %v", names, expected)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Errorf("Got %#v, expected %#v", names[i], expected[i])
+		}
+	}
+	if !names[3].IsOthers() || names[0].IsOthers() {
+		t.Errorf("Got wrong result from IsOthers")
+	}
+}
+
+func TestFormatName(t *testing.T) {
+	names := []Name{
+		{First: "Jean", Von: "de la", Last: "Fontaine"},
+		{First: "Henry", Last: "Ford", Jr: "Jr."},
+		{Von: "van", Last: "Gogh"},
+		{Last: "Smith", Jr: "Jr."},
+	}
+	expected := map[NameFormat]string{
+		FirstVonLast:   "Jean de la Fontaine and Ford, Jr., Henry and van Gogh and Smith, Jr., ",
+		VonLastFirst:   "de la Fontaine, Jean and Ford, Jr., Henry and van Gogh and Smith, Jr., ",
+		VonLastJrFirst: "de la Fontaine, Jean and Ford, Jr., Henry and van Gogh and Smith, Jr., ",
+	}
+	for f, s := range expected {
+		if got := FormatNames(names, f); got != s {
+			t.Errorf("Got %q, expected %q", got, s)
+		}
+		// every form parses back into the same names
+		parsed := ParseNames(s)
+		if len(parsed) != len(names) {
+			t.Errorf("Got %d names, expected %d", len(parsed), len(names))
+		}
+		for i, n := range parsed {
+			if n != names[i] {
+				t.Errorf("Got %#v, expected %#v", n, names[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package biblexer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"unicode/utf8"
+)
+
+// Parser builds a parse tree from the tokens produced by a Lexer.
+// The parser fills its macro table from @string definitions in input
+// order, and expands the values of fields and preambles as it goes.
+type Parser struct {
+	lex    *Lexer
+	peeked *Token       // the token returned by peek, if any
+	macros *MacroTable  // the macros defined so far
+	diags  []Diagnostic // the problems found in entries so far
+}
+
+// NewParser creates a new parser for the tokens produced by l.
+func NewParser(l *Lexer) *Parser {
+	return &Parser{lex: l, macros: NewMacroTable()}
+}
+
+// Macros returns the parser's macro table. Macros added to the table
+// before parsing are available to the input.
+func (p *Parser) Macros() *MacroTable {
+	return p.macros
+}
+
+// Diagnostics returns the problems found in the entries parsed so far,
+// such as duplicate fields.
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diags
+}
+
+// Parse parses the input string and returns its parse tree.
+func Parse(name, input string) (*FileNode, error) {
+	return NewParser(NewLexer(name, input)).Parse()
+}
+
+// Parse parses the remaining input and returns its parse tree.
+// On error, the returned tree holds the nodes parsed before the error.
+// If the lexer recovers from errors, Parse skips the entries in error,
+// and returns the tree of the other entries and an ErrorList.
+func (p *Parser) Parse() (*FileNode, error) {
+	f := &FileNode{NodeType: NodeFile, Name: p.lex.name, Macros: p.macros}
+	var errs ErrorList
+	for {
+		n, err := p.Next()
+		if err == io.EOF {
+			f.Pos = Pos{0, 1, 1, p.peek().Pos.End}
+			f.Diagnostics = p.diags
+			return f, errs.Err()
+		}
+		var list ErrorList
+		var serr *SyntaxError
+		switch {
+		case err != nil && p.lex.recover && errors.As(err, &list):
+			errs = append(errs, list...)
+			continue
+		case err != nil && p.lex.recover && errors.As(err, &serr):
+			errs = append(errs, serr)
+			continue
+		}
+		if err != nil {
+			f.Diagnostics = p.diags
+			return f, err
+		}
+		f.Nodes = append(f.Nodes, n)
+	}
+}
+
+// Next parses and returns the next top-level node. At the end of
+// the input, Next returns io.EOF, or the error of the input reader
+// if it failed. If the lexer recovers from errors, and the rest of an
+// entry in error holds more syntax errors, Next returns an ErrorList.
+func (p *Parser) Next() (Node, error) {
+	switch tok := p.next(); tok.Kind {
+	case EOF:
+		if p.lex.rerr != nil {
+			return nil, p.lex.rerr
+		}
+		return nil, io.EOF
+	case Error:
+		return nil, p.lex.lastErr()
+	case EntryTypeDelim:
+		n, err := p.entry(tok)
+		if err != nil && p.lex.recover {
+			err = p.resync(err)
+		}
+		return n, err
+	default:
+		err := p.unexpected(tok, StateStart, EntryTypeDelim)
+		if p.lex.recover {
+			err = p.resync(err)
+		}
+		return nil, err
+	}
+}
+
+// Entries returns an iterator over the remaining entries, decoded as by
+// DecodeEntry. @string, @preamble and @comment entries are skipped,
+// though @string entries still define macros. Entries with fields that
+// cannot be decoded are yielded with their error. Other errors are
+// yielded with a zero Entry, and end the iteration, unless the lexer
+// recovers from syntax errors.
+func (p *Parser) Entries() iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		for {
+			n, err := p.Next()
+			if err == io.EOF {
+				return
+			}
+			var serr *SyntaxError
+			if err != nil {
+				if !yield(Entry{}, err) || !p.lex.recover || !errors.As(err, &serr) {
+					return
+				}
+				continue
+			}
+			if n, ok := n.(*EntryNode); ok {
+				if !yield(DecodeEntry(n)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// resync skips the tokens up to the next entry, after the error err.
+// It returns err, or an ErrorList of err and the syntax errors of the
+// Error tokens it skipped.
+func (p *Parser) resync(err error) error {
+	var list ErrorList
+	for k := p.peek().Kind; k != EntryTypeDelim && k != EOF; k = p.peek().Kind {
+		if p.next().Kind != Error {
+			continue
+		}
+		if serr, ok := p.lex.lastErr().(*SyntaxError); ok {
+			list = append(list, serr)
+		}
+	}
+	var serr *SyntaxError
+	if len(list) == 0 || !errors.As(err, &serr) {
+		return err
+	}
+	return append(ErrorList{serr}, list...)
+}
+
+// next returns the next token.
+func (p *Parser) next() Token {
+	if p.peeked != nil {
+		tok := *p.peeked
+		p.peeked = nil
+		return tok
+	}
+	return p.token()
+}
+
+// token returns the next token from the lexer, skipping comments, and
+// white space and junk if the lexer keeps trivia.
+func (p *Parser) token() Token {
+	for {
+		tok := p.lex.NextToken()
+		if tok.Kind != Comment && tok.Kind != Space && tok.Kind != Junk {
+			return tok
+		}
+	}
+}
+
+// peek returns but does not consume the next token.
+func (p *Parser) peek() Token {
+	if p.peeked == nil {
+		tok := p.token()
+		p.peeked = &tok
+	}
+	return *p.peeked
+}
+
+// expect consumes the next token and reports an error
+// unless it is of the given kind.
+func (p *Parser) expect(kind Kind, state State) (Token, error) {
+	tok := p.next()
+	if tok.Kind != kind {
+		return tok, p.unexpected(tok, state, kind)
+	}
+	return tok, nil
+}
+
+// unexpected returns the error for the unexpected token tok.
+func (p *Parser) unexpected(tok Token, state State, expected ...Kind) error {
+	if tok.Kind == Error {
+		return p.lex.lastErr()
+	}
+	r := rune(eof)
+	if tok.Kind != EOF {
+		r, _ = utf8.DecodeRuneInString(tok.Val)
+	}
+	return &SyntaxError{Name: p.lex.name, Pos: tok.Pos, Rune: r, State: state, Expected: expected}
+}
+
+// entry parses an entry, @string definition, @preamble or @comment
+// entry following the @ delimiter.
+func (p *Parser) entry(delim Token) (Node, error) {
+	typ, err := p.expect(EntryType, StateEntryType)
+	if err != nil {
+		return nil, err
+	}
+	start, err := p.expect(EntryStartDelim, StateEntryType)
+	if err != nil {
+		return nil, err
+	}
+	d := Braces
+	if start.Val == "(" {
+		d = Parens
+	}
+	if strings.EqualFold(typ.Val, "preamble") {
+		return p.preamble(delim, typ, d)
+	}
+	switch tok := p.next(); tok.Kind {
+	case CommentEntry:
+		stop, err := p.expect(EntryStopDelim, StateComment)
+		if err != nil {
+			return nil, err
+		}
+		return &CommentNode{NodeType: NodeComment, Pos: span(delim.Pos, stop.Pos), EntryType: typ.Val, Delim: d, Text: tok.Val}, nil
+	case StringKey:
+		return p.stringDef(delim, typ, tok, d)
+	case CiteKey:
+		if _, err := p.expect(Comma, StateCiteKey); err != nil {
+			return nil, err
+		}
+		e := &EntryNode{NodeType: NodeEntry, EntryType: typ.Val, Delim: d, Key: tok.Val}
+		for {
+			switch tok := p.next(); tok.Kind {
+			case EntryStopDelim:
+				e.Pos = span(delim.Pos, tok.Pos)
+				return e, nil
+			case TagName:
+				f, err := p.field(tok)
+				if err != nil {
+					return nil, err
+				}
+				if prev := e.Field(f.Name); prev != nil {
+					p.diags = append(p.diags, Diagnostic{f.Pos, fmt.Sprintf("duplicate field %q; DecodeEntry keeps the first, at %s", f.Name, prev.Pos)})
+				}
+				e.Fields = append(e.Fields, f)
+				if p.peek().Kind == Comma {
+					p.next()
+				}
+			default:
+				return nil, p.unexpected(tok, StateTagName, TagName, EntryStopDelim)
+			}
+		}
+	default:
+		return nil, p.unexpected(tok, StateCiteKey, CiteKey, StringKey)
+	}
+}
+
+// stringDef parses the remainder of an @string definition.
+func (p *Parser) stringDef(delim, typ, key Token, d Delim) (Node, error) {
+	if !strings.EqualFold(typ.Val, "string") {
+		return nil, p.unexpected(key, StateCiteKey, CiteKey)
+	}
+	if _, err := p.expect(Equal, StateCiteKey); err != nil {
+		return nil, err
+	}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Kind == Comma {
+		p.next()
+	}
+	stop, err := p.expect(EntryStopDelim, StateTagDelim)
+	if err != nil {
+		return nil, err
+	}
+	p.macros.Define(key.Val, v.Expanded, key.Pos)
+	return &StringNode{NodeType: NodeString, Pos: span(delim.Pos, stop.Pos), EntryType: typ.Val, Delim: d, Key: key.Val, Value: v}, nil
+}
+
+// preamble parses the remainder of a @preamble entry.
+func (p *Parser) preamble(delim, typ Token, d Delim) (Node, error) {
+	n := &PreambleNode{NodeType: NodePreamble, EntryType: typ.Val, Delim: d}
+	if p.peek().Kind != EntryStopDelim {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		n.Value = v
+	}
+	stop, err := p.expect(EntryStopDelim, StateTagDelim)
+	if err != nil {
+		return nil, err
+	}
+	n.Pos = span(delim.Pos, stop.Pos)
+	return n, nil
+}
+
+// field parses a field following its tag name.
+func (p *Parser) field(name Token) (*FieldNode, error) {
+	if _, err := p.expect(Equal, StateTagName); err != nil {
+		return nil, err
+	}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return &FieldNode{NodeType: NodeField, Pos: span(name.Pos, v.Pos), Name: name.Val, Value: v}, nil
+}
+
+// value parses a sequence of text and macros joined by #.
+func (p *Parser) value() (*ValueNode, error) {
+	v := &ValueNode{NodeType: NodeValue}
+	for {
+		part, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		v.Parts = append(v.Parts, part)
+		if p.peek().Kind != Concat {
+			break
+		}
+		p.next()
+	}
+	v.Pos = span(v.Parts[0].Position(), v.Parts[len(v.Parts)-1].Position())
+	v.Expanded = p.macros.Expand(v)
+	return v, nil
+}
+
+// operand parses delimited text, a number or a macro reference.
+func (p *Parser) operand() (Node, error) {
+	switch tok := p.next(); tok.Kind {
+	case StringKey:
+		return &MacroNode{NodeType: NodeMacro, Pos: tok.Pos, Name: tok.Val}, nil
+	case Number:
+		return &NumberNode{NodeType: NodeNumber, Pos: tok.Pos, Text: tok.Val}, nil
+	case TagContentStartDelim:
+		return p.text(tok, Braces, TagContentStopDelim)
+	case QuoteDelim:
+		return p.text(tok, Quotes, QuoteDelim)
+	default:
+		return nil, p.unexpected(tok, StateContentStart, TagContentStartDelim, QuoteDelim, StringKey, Number)
+	}
+}
+
+// text parses the content and closing delimiter of delimited text.
+func (p *Parser) text(open Token, delim Delim, closing Kind) (Node, error) {
+	content, err := p.expect(TagContent, StateContent)
+	if err != nil {
+		return nil, err
+	}
+	stop, err := p.expect(closing, StateContent)
+	if err != nil {
+		return nil, err
+	}
+	return &TextNode{NodeType: NodeText, Pos: span(open.Pos, stop.Pos), Delim: delim, Text: content.Val}, nil
+}
@@ -0,0 +1,256 @@
+package biblexer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var parseInput = `% junk before the first entry
+@string{ gopher = "Mrs. Gopher" }
+@article{c72,
+	author = gopher # "Mr. Pike",
+	title = {The {Go} Paper},
+}
+@book{k2, title = "Second" # {Edition}}
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse("bib", parseInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Nodes) != 3 {
+		t.Fatalf("Got %d nodes, expected 3", len(f.Nodes))
+	}
+	s, ok := f.Nodes[0].(*StringNode)
+	if !ok || s.Key != "gopher" || s.Value.String() != `"Mrs. Gopher"` {
+		t.Errorf("Got %s, expected @string gopher definition", f.Nodes[0])
+	}
+	e, ok := f.Nodes[1].(*EntryNode)
+	if !ok || e.EntryType != "article" || e.Key != "c72" || len(e.Fields) != 2 {
+		t.Fatalf("Got %s, expected article c72 with 2 fields", f.Nodes[1])
+	}
+	author := e.Field("AUTHOR")
+	if author == nil || len(author.Value.Parts) != 2 {
+		t.Fatalf("Got %v, expected author with 2 parts", author)
+	}
+	if m, ok := author.Value.Parts[0].(*MacroNode); !ok || m.Name != "gopher" {
+		t.Errorf("Got %s, expected macro gopher", author.Value.Parts[0])
+	}
+	if txt, ok := author.Value.Parts[1].(*TextNode); !ok || txt.Delim != Quotes || txt.Text != "Mr. Pike" {
+		t.Errorf("Got %s, expected quoted text", author.Value.Parts[1])
+	}
+	if got := e.Field("title").Value.String(); got != "{The {Go} Paper}" {
+		t.Errorf("Got %s, expected %s", got, "{The {Go} Paper}")
+	}
+	if e.Pos.Line != 3 || e.Pos.Column != 1 || parseInput[e.Pos.Offset] != '@' || parseInput[e.Pos.End-1] != '}' {
+		t.Errorf("Got %+v, expected entry to span from @ to }", e.Pos)
+	}
+	b := f.Nodes[2].(*EntryNode)
+	if got := b.String(); got != "@book{k2,\n  title = \"Second\" # {Edition},\n}" {
+		t.Errorf("Got %q", got)
+	}
+}
+
+func TestParseString(t *testing.T) {
+	f, err := Parse("bib", parseInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := Parse("bib", f.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.String() != g.String() {
+		t.Errorf("Got %s, expected %s", g, f)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, input := range failSet {
+		f, err := Parse("bib", "@misc{ok, note = {first}}\n"+input)
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Fatalf("Got %v, expected a *SyntaxError", err)
+		}
+		if serr.Pos.Line < 2 {
+			t.Errorf("Got error at line %d, expected line 2 or later", serr.Pos.Line)
+		}
+		if len(f.Nodes) != 1 {
+			t.Errorf("Got %d nodes, expected the 1 node before the error", len(f.Nodes))
+		}
+	}
+}
+
+func TestParseComment(t *testing.T) {
+	const body = `jabref-meta: grouping:
+0 AllEntriesGroup:;
+1 StaticGroup:{Go}\\;0;1;;;;
+`
+	input := "@Comment{" + body + "}\n"
+	f, err := Parse("bib", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := f.Nodes[0].(*CommentNode)
+	if !ok || c.Text != body {
+		t.Fatalf("Got %s, expected comment with body %q", f.Nodes[0], body)
+	}
+	if got := f.String(); got != input {
+		t.Errorf("Got %q, expected %q", got, input)
+	}
+	// parentheses nest in a parenthesized comment
+	const parens = "@comment(foo (bar) baz)\n"
+	f, err = Parse("bib", parens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := f.Nodes[0].(*CommentNode); !ok || c.Text != "foo (bar) baz" || f.String() != parens {
+		t.Errorf("Got %q, expected %q", f, parens)
+	}
+}
+
+func TestParsePreamble(t *testing.T) {
+	const input = `@preamble{ "\newcommand{\noopsort}[1]{}" # macro }
+@preamble{}
+`
+	f, err := Parse("bib", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preambles := f.Preambles()
+	if len(preambles) != 2 {
+		t.Fatalf("Got %d preambles, expected 2", len(preambles))
+	}
+	if got := preambles[0].Value.String(); got != `"\newcommand{\noopsort}[1]{}" # macro` {
+		t.Errorf("Got %s", got)
+	}
+	if preambles[1].Value != nil {
+		t.Errorf("Got %s, expected empty preamble", preambles[1])
+	}
+	g, err := Parse("bib", f.String())
+	if err != nil || g.String() != f.String() {
+		t.Errorf("Got %s (%v), expected %s", g, err, f)
+	}
+}
+
+func TestParseParens(t *testing.T) {
+	const input = `@string(gopher = "Mrs. Gopher")
+@comment(a {)} comment)
+@preamble("\\noopsort")
+@article(c72, author = {Gopher}, title = {On (parens)})
+@book{k2, title = {On braces}}
+`
+	f, err := Parse("bib", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Delim{Parens, Parens, Parens, Parens, Braces}
+	for i, n := range f.Nodes {
+		var d Delim
+		switch n := n.(type) {
+		case *StringNode:
+			d = n.Delim
+		case *CommentNode:
+			d = n.Delim
+		case *PreambleNode:
+			d = n.Delim
+		case *EntryNode:
+			d = n.Delim
+		}
+		if d != expected[i] {
+			t.Errorf("Got %v for %s, expected %v", d, n, expected[i])
+		}
+	}
+	g, err := Parse("bib", f.String())
+	if err != nil || g.String() != f.String() {
+		t.Errorf("Got %s (%v), expected %s", g, err, f)
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	f, err := Parse("bib", `@article{c72, year = 2020, volume = "1" # 2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := f.Nodes[0].(*EntryNode)
+	if n, ok := e.Field("year").Value.Parts[0].(*NumberNode); !ok || n.Text != "2020" {
+		t.Errorf("Got %s, expected number 2020", e.Field("year").Value)
+	}
+	if n, ok := e.Field("volume").Value.Parts[1].(*NumberNode); !ok || n.Text != "2" {
+		t.Errorf("Got %s, expected number 2", e.Field("volume").Value)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	f, err := Parse("bib", `@article{c72, author = gopher # " and Mr. Pike", note = {say "hi"} # "{"}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := f.Nodes[0].(*EntryNode)
+	if got := e.Field("author").Value.String(); got != `gopher # " and Mr. Pike"` {
+		t.Errorf("Got %s, expected %s", got, `gopher # " and Mr. Pike"`)
+	}
+	if got := e.Field("note").Value.String(); got != `{say "hi"} # "{"}"` {
+		t.Errorf("Got %s, expected %s", got, `{say "hi"} # "{"}"`)
+	}
+}
+
+func TestParseRecover(t *testing.T) {
+	f, err := NewParser(NewLexer("bib", recoverInput, RecoverErrors())).Parse()
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 3 {
+		t.Fatalf("Got %v, expected 3 errors", err)
+	}
+	var keys []string
+	for _, n := range f.Nodes {
+		keys = append(keys, n.(*EntryNode).Key)
+	}
+	if got, expected := strings.Join(keys, " "), "a1 b2 m4 m6"; got != expected {
+		t.Errorf("Got keys %s, expected %s", got, expected)
+	}
+	// the lexer errors in the rest of an entry in error are kept
+	_, err = NewParser(NewLexer("bib", `@article{foo = {x}, title = "a } b"}`, RecoverErrors())).Parse()
+	if !errors.As(err, &list) || len(list) != 2 || list[0].Rune != 'f' || list[1].Rune != '}' {
+		t.Errorf("Got %v, expected errors for 'f' and '}'", err)
+	}
+}
+
+func TestParserEntries(t *testing.T) {
+	var keys []string
+	for e, err := range NewParser(NewLexer("bib", parseInput)).Entries() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, e.Key)
+		if e.Key == "c72" && e.Author() != "Mrs. GopherMr. Pike" {
+			t.Errorf("Got %q, expected the expanded author", e.Author())
+		}
+	}
+	if got := strings.Join(keys, " "); got != "c72 k2" {
+		t.Errorf("Got keys %s, expected c72 k2", got)
+	}
+	// a syntax error ends the iteration, unless recovering
+	var errs []error
+	keys = nil
+	for e, err := range NewParser(NewLexer("bib", recoverInput, RecoverErrors())).Entries() {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys = append(keys, e.Key)
+	}
+	if got := strings.Join(keys, " "); got != "a1 b2 m4 m6" || len(errs) != 3 {
+		t.Errorf("Got keys %s and %d errors, expected a1 b2 m4 m6 and 3 errors", got, len(errs))
+	}
+	errs = nil
+	for _, err := range NewParser(NewLexer("bib", recoverInput)).Entries() {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 {
+		t.Errorf("Got %d errors, expected 1", len(errs))
+	}
+}
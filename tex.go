@@ -0,0 +1,610 @@
+package biblexer
+
+import (
+	"fmt"
+	"html"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// TextFormat identifies the output format of DecodeTeX.
+type TextFormat int
+
+const (
+	PlainText TextFormat = iota // Unicode text
+	HTML                        // Unicode text with HTML markup
+	Markdown                    // Unicode text with Markdown markup
+)
+
+// An UnknownCommandError reports the TeX commands that DecodeTeX could
+// not convert. The commands and their arguments are kept as written.
+type UnknownCommandError struct {
+	Commands []string // the unknown commands in order, e.g. `\cite`
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("biblexer: unknown TeX commands %s", strings.Join(e.Commands, " "))
+}
+
+// DecodeTeX converts the TeX markup in s, such as the content of a
+// field, to Unicode text in the format f. It converts accents, special
+// characters, ligatures such as -- and ---, ties, math mode letters and
+// symbols, and font commands such as \emph and {\it ...}, which become
+// spans in HTML and Markdown. Braces are removed, and white space is
+// reduced to one space. If s contains commands that cannot be
+// converted, DecodeTeX returns the text with the commands kept as
+// written, and an *UnknownCommandError.
+func DecodeTeX(s string, f TextFormat) (string, error) {
+	d := &texDecoder{s: s, f: f, out: new(strings.Builder)}
+	d.group(false)
+	if len(d.unknown) > 0 {
+		return d.out.String(), &UnknownCommandError{Commands: d.unknown}
+	}
+	return d.out.String(), nil
+}
+
+// texDecoder holds the state of DecodeTeX.
+type texDecoder struct {
+	s       string
+	pos     int
+	f       TextFormat
+	out     *strings.Builder
+	math    bool     // whether in math mode
+	unknown []string // the unknown commands seen so far
+}
+
+// group decodes up to the end of the current group: the closing brace
+// if braced, or else the end of the input.
+func (d *texDecoder) group(braced bool) {
+	var styles []texStyle // the styles switched on in this group
+	defer func() {
+		for i := len(styles) - 1; i >= 0; i-- {
+			d.close(styles[i])
+		}
+	}()
+	for d.pos < len(d.s) {
+		switch c := d.s[d.pos]; c {
+		case '}':
+			d.pos++
+			if braced {
+				return
+			}
+			// ignore an unbalanced brace
+		case '{':
+			d.pos++
+			d.group(true)
+		case '\\':
+			if style, ok := d.command(); ok {
+				d.open(style)
+				styles = append(styles, style)
+			}
+		case '$':
+			d.pos++
+			d.math = !d.math
+		case '~':
+			d.pos++
+			d.text("\u00a0")
+		case ' ', '\t', '\n', '\r':
+			for d.pos < len(d.s) && isSpace(rune(d.s[d.pos])) {
+				d.pos++
+			}
+			d.text(" ")
+		default:
+			d.ligature()
+		}
+	}
+}
+
+// texLigatures lists the ligatures of the TeX text fonts, longest first.
+var texLigatures = []struct{ tex, text string }{
+	{"---", "—"},
+	{"--", "–"},
+	{"``", "“"},
+	{"''", "”"},
+	{"!`", "¡"},
+	{"?`", "¿"},
+	{"`", "‘"},
+	{"'", "’"},
+}
+
+// ligature decodes a ligature, or else a single rune.
+func (d *texDecoder) ligature() {
+	if !d.math {
+		for _, l := range texLigatures {
+			if strings.HasPrefix(d.s[d.pos:], l.tex) {
+				d.pos += len(l.tex)
+				d.text(l.text)
+				return
+			}
+		}
+	}
+	_, n := utf8.DecodeRuneInString(d.s[d.pos:])
+	d.text(d.s[d.pos : d.pos+n])
+	d.pos += n
+}
+
+// command decodes the command at the backslash. If the command is a
+// font switch, such as \it, it returns the style to switch on for the
+// rest of the group.
+func (d *texDecoder) command() (texStyle, bool) {
+	cs := controlSequence(d.s[d.pos:])
+	d.pos += len(cs)
+	if len(cs) > 1 && isLetter(cs[1]) && !d.math {
+		// spaces after a control word are ignored; in math mode, they
+		// are kept to space out the symbols as written
+		for d.pos < len(d.s) && isSpace(rune(d.s[d.pos])) {
+			d.pos++
+		}
+	}
+	name := cs[1:]
+	if s, ok := texSymbols[name]; ok {
+		d.text(s)
+		return texStyle{}, false
+	}
+	if s, ok := texMathSymbols[name]; ok {
+		d.text(s)
+		return texStyle{}, false
+	}
+	if a, ok := texAccents[name]; ok {
+		d.text(a.compose(d.arg()))
+		return texStyle{}, false
+	}
+	if style, ok := texStyles[name]; ok {
+		d.open(style)
+		d.argInto()
+		d.close(style)
+		return texStyle{}, false
+	}
+	if style, ok := texSwitches[name]; ok {
+		return style, true
+	}
+	switch name {
+	case "-", "/", "@", "relax", "protect", "nobreak", "xspace", "ignorespaces":
+		// no output
+	case "noopsort", "SortNoop":
+		// the argument is only used for sorting
+		d.rawArg()
+	case "\\":
+		d.markup(map[TextFormat]string{PlainText: "\n", HTML: "<br>", Markdown: "  \n"}[d.f])
+	case "enquote":
+		d.text("“")
+		d.argInto()
+		d.text("”")
+	case "url":
+		u := d.rawArg()
+		switch d.f {
+		case HTML:
+			d.markup(`<a href="` + html.EscapeString(u) + `">`)
+			d.text(u)
+			d.markup("</a>")
+		case Markdown:
+			d.markup("<" + u + ">")
+		default:
+			d.text(u)
+		}
+	case "href":
+		u := d.rawArg()
+		switch d.f {
+		case HTML:
+			d.markup(`<a href="` + html.EscapeString(u) + `">`)
+			d.argInto()
+			d.markup("</a>")
+		case Markdown:
+			d.markup("[")
+			d.argInto()
+			d.markup("](" + u + ")")
+		default:
+			d.argInto()
+		}
+	default:
+		if !slices.Contains(d.unknown, cs) {
+			d.unknown = append(d.unknown, cs)
+		}
+		// keep the command and its braced arguments as written
+		start := d.pos
+		for d.pos < len(d.s) && d.s[d.pos] == '{' {
+			d.rawArg()
+		}
+		d.text(cs + d.s[start:d.pos])
+	}
+	return texStyle{}, false
+}
+
+// argInto decodes the argument of a command: a group, a command or a
+// single rune.
+func (d *texDecoder) argInto() {
+	for d.pos < len(d.s) && isSpace(rune(d.s[d.pos])) {
+		d.pos++
+	}
+	switch {
+	case d.pos == len(d.s):
+	case d.s[d.pos] == '{':
+		d.pos++
+		d.group(true)
+	case d.s[d.pos] == '\\':
+		if style, ok := d.command(); ok {
+			// a font switch as argument applies to nothing
+			d.open(style)
+			d.close(style)
+		}
+	default:
+		_, n := utf8.DecodeRuneInString(d.s[d.pos:])
+		d.text(d.s[d.pos : d.pos+n])
+		d.pos += n
+	}
+}
+
+// arg returns the decoded argument of a command without markup.
+func (d *texDecoder) arg() string {
+	out, f := d.out, d.f
+	d.out, d.f = new(strings.Builder), PlainText
+	d.argInto()
+	s := d.out.String()
+	d.out, d.f = out, f
+	return s
+}
+
+// rawArg returns the argument of a command as written, without braces.
+func (d *texDecoder) rawArg() string {
+	for d.pos < len(d.s) && isSpace(rune(d.s[d.pos])) {
+		d.pos++
+	}
+	if d.pos == len(d.s) {
+		return ""
+	}
+	if d.s[d.pos] != '{' {
+		_, n := utf8.DecodeRuneInString(d.s[d.pos:])
+		d.pos += n
+		return d.s[d.pos-n : d.pos]
+	}
+	start, braces := d.pos+1, 0
+	for ; d.pos < len(d.s); d.pos++ {
+		switch d.s[d.pos] {
+		case '{':
+			braces++
+		case '}':
+			if braces--; braces == 0 {
+				d.pos++
+				return d.s[start : d.pos-1]
+			}
+		}
+	}
+	return d.s[start:]
+}
+
+// text writes the text s, escaped for the output format.
+func (d *texDecoder) text(s string) {
+	switch d.f {
+	case HTML:
+		s = html.EscapeString(s)
+	case Markdown:
+		s = markdownEscaper.Replace(s)
+	}
+	d.out.WriteString(s)
+}
+
+// markup writes s as is.
+func (d *texDecoder) markup(s string) {
+	d.out.WriteString(s)
+}
+
+// markdownEscaper escapes the characters that have a meaning in Markdown.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`,
+)
+
+// texStyle describes the markup of a font command in HTML and Markdown.
+// Without a Markdown delimiter, the HTML element is used in Markdown too.
+type texStyle struct {
+	html string // the HTML element, e.g. "em"
+	md   string // the Markdown delimiter, e.g. "*"
+}
+
+// open writes the markup that starts the style.
+func (d *texDecoder) open(s texStyle) {
+	switch {
+	case d.f == Markdown && s.md != "":
+		d.markup(s.md)
+	case d.f != PlainText && s.html != "":
+		d.markup("<" + s.html + ">")
+	}
+}
+
+// close writes the markup that ends the style.
+func (d *texDecoder) close(s texStyle) {
+	switch {
+	case d.f == Markdown && s.md != "":
+		d.markup(s.md)
+	case d.f != PlainText && s.html != "":
+		tag, _, _ := strings.Cut(s.html, " ")
+		d.markup("</" + tag + ">")
+	}
+}
+
+var (
+	styleItalic    = texStyle{"i", "*"}
+	styleEmphasis  = texStyle{"em", "*"}
+	styleBold      = texStyle{"b", "**"}
+	styleCode      = texStyle{"code", "`"}
+	styleSmallCaps = texStyle{`span style="font-variant:small-caps"`, ""}
+	styleSuper     = texStyle{"sup", ""}
+	styleSub       = texStyle{"sub", ""}
+	styleUnderline = texStyle{"u", ""}
+	stylePlain     = texStyle{}
+)
+
+// texStyles maps the font commands that take an argument to their styles.
+var texStyles = map[string]texStyle{
+	"textit": styleItalic, "textsl": styleItalic, "mathit": styleItalic,
+	"emph":   styleEmphasis,
+	"textbf": styleBold, "mathbf": styleBold,
+	"texttt": styleCode, "mathtt": styleCode,
+	"textsc":          styleSmallCaps,
+	"textsuperscript": styleSuper, "textsubscript": styleSub,
+	"underline": styleUnderline,
+	"textrm":    stylePlain, "textsf": stylePlain, "textup": stylePlain, "textmd": stylePlain,
+	"textnormal": stylePlain, "mathrm": stylePlain, "mbox": stylePlain, "hbox": stylePlain,
+	"text": stylePlain, "ensuremath": stylePlain, "NoCaseChange": stylePlain,
+}
+
+// texSwitches maps the font commands that apply to the rest of the
+// group to their styles.
+var texSwitches = map[string]texStyle{
+	"it": styleItalic, "itshape": styleItalic, "sl": styleItalic, "slshape": styleItalic,
+	"em": styleEmphasis,
+	"bf": styleBold, "bfseries": styleBold,
+	"tt": styleCode, "ttfamily": styleCode,
+	"sc": styleSmallCaps, "scshape": styleSmallCaps,
+	"rm": stylePlain, "sf": stylePlain, "upshape": stylePlain, "normalfont": stylePlain, "mdseries": stylePlain,
+	"displaystyle": stylePlain, "textstyle": stylePlain,
+}
+
+// texSymbols maps the TeX commands for special characters and symbols
+// to their text.
+var texSymbols = map[string]string{
+	// escaped characters and spaces
+	"&": "&", "%": "%", "$": "$", "#": "#", "_": "_", "{": "{", "}": "}",
+	" ": " ", ",": "\u2009", ";": " ", ":": " ", "!": "",
+	"quad": "\u2003", "qquad": "\u2003\u2003", "space": " ", "enspace": "\u2002", "thinspace": "\u2009",
+	// letters
+	"ss": "ß", "SS": "SS", "ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ",
+	"aa": "å", "AA": "Å", "o": "ø", "O": "Ø", "l": "ł", "L": "Ł",
+	"i": "ı", "j": "ȷ", "dh": "ð", "DH": "Ð", "th": "þ", "TH": "Þ",
+	"dj": "đ", "DJ": "Đ", "ng": "ŋ", "NG": "Ŋ",
+	// text symbols
+	"copyright": "©", "textcopyright": "©", "textregistered": "®", "texttrademark": "™",
+	"S": "§", "textsection": "§", "P": "¶", "textparagraph": "¶",
+	"dag": "†", "textdagger": "†", "ddag": "‡", "textdaggerdbl": "‡",
+	"pounds": "£", "textsterling": "£", "euro": "€", "texteuro": "€", "textyen": "¥",
+	"textcent": "¢", "textdollar": "$", "textdegree": "°", "textperthousand": "‰",
+	"ldots": "…", "dots": "…", "textellipsis": "…",
+	"textendash": "–", "textemdash": "—", "textquoteleft": "‘", "textquoteright": "’",
+	"textquotedblleft": "“", "textquotedblright": "”", "quotedblbase": "„", "quotesinglbase": "‚",
+	"guillemotleft": "«", "guillemotright": "»", "guilsinglleft": "‹", "guilsinglright": "›",
+	"textless": "<", "textgreater": ">", "textbackslash": `\`, "textasciitilde": "~",
+	"textasciicircum": "^", "textbar": "|", "textbraceleft": "{", "textbraceright": "}",
+	"textunderscore": "_", "textbullet": "•", "textperiodcentered": "·",
+	"textexclamdown": "¡", "textquestiondown": "¿", "textordfeminine": "ª", "textordmasculine": "º",
+	"textmu": "µ", "textonehalf": "½", "textonequarter": "¼", "textthreequarters": "¾",
+	"textnumero": "№", "textasteriskcentered": "∗", "textvisiblespace": "␣",
+	"slash": "/", "LaTeX": "LaTeX", "TeX": "TeX", "BibTeX": "BibTeX", "LaTeXe": "LaTeX2ε",
+}
+
+// texMathSymbols maps the TeX commands for letters and symbols in math
+// mode to their text. DecodeTeX accepts them in text mode too.
+var texMathSymbols = map[string]string{
+	// letters
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"ell": "ℓ", "hbar": "ℏ", "aleph": "ℵ", "emptyset": "∅",
+	// symbols
+	"times": "×", "div": "÷", "pm": "±", "mp": "∓", "cdot": "⋅", "ast": "∗", "circ": "∘",
+	"bullet": "∙", "leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "propto": "∝", "ll": "≪", "gg": "≫",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "sum": "∑", "prod": "∏", "int": "∫",
+	"sqrt": "√", "in": "∈", "notin": "∉", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+	"supseteq": "⊇", "cup": "∪", "cap": "∩", "forall": "∀", "exists": "∃", "neg": "¬",
+	"wedge": "∧", "land": "∧", "vee": "∨", "lor": "∨", "oplus": "⊕", "otimes": "⊗",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "mapsto": "↦",
+	"uparrow": "↑", "downarrow": "↓", "langle": "⟨", "rangle": "⟩", "cdots": "⋯",
+	"vdots": "⋮", "ddots": "⋱", "prime": "′", "star": "⋆", "mid": "∣", "parallel": "∥",
+	"perp": "⊥", "angle": "∠", "triangle": "△", "Box": "□", "log": "log", "exp": "exp",
+	"sin": "sin", "cos": "cos", "max": "max", "min": "min", "lim": "lim",
+}
+
+// texAccent describes a TeX accent command: its combining mark, and the
+// letters that combine with the accent into a precomposed letter,
+// followed by those precomposed letters in the same order.
+type texAccent struct {
+	mark     rune
+	bases    string
+	composed string
+}
+
+// texAccents maps the TeX accent commands to their accents.
+var texAccents = map[string]texAccent{
+	"`":  {'\u0300', "AEIOUaeiouÜüNnĒēŌōWwÂâĂăÊêÔôƠơƯưYy", "ÀÈÌÒÙàèìòùǛǜǸǹḔḕṐṑẀẁẦầẰằỀềỒồỜờỪừỲỳ"},
+	"'":  {'\u0301', "AEIOUYaeiouyCcLlNnRrSsZzÜüGgÅåÆæØøÇçĒēÏïKkMmÕõŌōPpŨũWwÂâĂăÊêÔôƠơƯư", "ÁÉÍÓÚÝáéíóúýĆćĹĺŃńŔŕŚśŹźǗǘǴǵǺǻǼǽǾǿḈḉḖḗḮḯḰḱḾḿṌṍṒṓṔṕṸṹẂẃẤấẮắẾếỐốỚớỨứ"},
+	"^":  {'\u0302', "AEIOUaeiouCcGgHhJjSsWwYyZzẠạẸẹỌọ", "ÂÊÎÔÛâêîôûĈĉĜĝĤĥĴĵŜŝŴŵŶŷẐẑẬậỆệỘộ"},
+	"~":  {'\u0303', "ANOanoIiUuVvÂâĂăEeÊêÔôƠơƯưYy", "ÃÑÕãñõĨĩŨũṼṽẪẫẴẵẼẽỄễỖỗỠỡỮữỸỹ"},
+	"=":  {'\u0304', "AaEeIiOoUuÜüÄäȦȧÆæǪǫÖöÕõȮȯYyGgḶḷṚṛ", "ĀāĒēĪīŌōŪūǕǖǞǟǠǡǢǣǬǭȪȫȬȭȰȱȲȳḠḡḸḹṜṝ"},
+	"u":  {'\u0306', "AaEeGgIiOoUuȨȩẠạ", "ĂăĔĕĞğĬĭŎŏŬŭḜḝẶặ"},
+	".":  {'\u0307', "CcEeGgIZzAaOoBbDdFfHhMmNnPpRrSsŚśŠšṢṣTtWwXxYy", "ĊċĖėĠġİŻżȦȧȮȯḂḃḊḋḞḟḢḣṀṁṄṅṖṗṘṙṠṡṤṥṦṧṨṩṪṫẆẇẊẋẎẏ"},
+	"\"": {'\u0308', "AEIOUaeiouyYHhÕõŪūWwXxt", "ÄËÏÖÜäëïöüÿŸḦḧṎṏṺṻẄẅẌẍẗ"},
+	"r":  {'\u030a', "AaUuwy", "ÅåŮůẘẙ"},
+	"H":  {'\u030b', "OoUu", "ŐőŰű"},
+	"v":  {'\u030c', "CcDdEeLlNnRrSsTtZzAaIiOoUuÜüGgKkƷʒjHh", "ČčĎďĚěĽľŇňŘřŠšŤťŽžǍǎǏǐǑǒǓǔǙǚǦǧǨǩǮǯǰȞȟ"},
+	"d":  {'\u0323', "BbDdHhKkLlMmNnRrSsTtVvWwZzAaEeIiOoƠơUuƯưYy", "ḄḅḌḍḤḥḲḳḶḷṂṃṆṇṚṛṢṣṬṭṾṿẈẉẒẓẠạẸẹỊịỌọỢợỤụỰựỴỵ"},
+	"c":  {'\u0327', "CcGgKkLlNnRrSsTtEeDdHh", "ÇçĢģĶķĻļŅņŖŗŞşŢţȨȩḐḑḨḩ"},
+	"k":  {'\u0328', "AaEeIiUuOo", "ĄąĘęĮįŲųǪǫ"},
+	"b":  {'\u0331', "BbDdKkLlNnRrTtZzh", "ḆḇḎḏḴḵḺḻṈṉṞṟṮṯẔẕẖ"},
+	"t":  {'\u0361', "", ""},
+}
+
+// compose applies the accent to the first letter of s, using the
+// precomposed letter if there is one, or else the combining mark. The
+// dotless letters \i and \j take the accent as the letters i and j.
+func (a texAccent) compose(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if n == 0 {
+		return string(a.mark)
+	}
+	switch r {
+	case 'ı':
+		r = 'i'
+	case 'ȷ':
+		r = 'j'
+	}
+	if i := slices.Index([]rune(a.bases), r); i >= 0 {
+		return string([]rune(a.composed)[i]) + s[n:]
+	}
+	return string(r) + string(a.mark) + s[n:]
+}
+
+// isLetter reports whether the byte c is an ASCII letter.
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// An UnmappableCharError reports the characters that EncodeTeX could not
+// convert to TeX. The characters are kept as written.
+type UnmappableCharError struct {
+	Chars []rune // the unmappable characters in order
+}
+
+func (e *UnmappableCharError) Error() string {
+	return fmt.Sprintf("biblexer: no TeX encoding for characters %q", string(e.Chars))
+}
+
+// EncodeTeX converts the non-ASCII characters in s to TeX, the reverse
+// of DecodeTeX: letters with accents and special letters become
+// brace-protected commands, such as {\"u} for ü and {\ss} for ß, dashes
+// and quotes become ligatures, and math letters and symbols become
+// commands in math mode, such as $\alpha$. Letters followed by
+// combining accents are converted like precomposed letters. ASCII is
+// kept as is, since s is taken to be TeX already. If s contains
+// characters that cannot be converted, EncodeTeX returns the text with
+// the characters kept as written, and an *UnmappableCharError.
+func EncodeTeX(s string) (string, error) {
+	var units []string // the TeX for each character
+	var unmappable []rune
+	for _, r := range s {
+		switch tex, ok := texEncodings[r]; {
+		case r < utf8.RuneSelf:
+			units = append(units, string(r))
+		case ok:
+			units = append(units, tex)
+		case texMarks[r] != "" && len(units) > 0:
+			// apply the combining accent to the previous character
+			last := units[len(units)-1]
+			if strings.HasPrefix(last, "{") && strings.HasSuffix(last, "}") {
+				last = last[1 : len(last)-1]
+			}
+			units[len(units)-1] = "{" + accentTeX(texMarks[r], last) + "}"
+		default:
+			if !slices.Contains(unmappable, r) {
+				unmappable = append(unmappable, r)
+			}
+			units = append(units, string(r))
+		}
+	}
+	if len(unmappable) > 0 {
+		return strings.Join(units, ""), &UnmappableCharError{Chars: unmappable}
+	}
+	return strings.Join(units, ""), nil
+}
+
+// texMarks maps the combining marks to the names of their accent commands.
+var texMarks = func() map[rune]string {
+	marks := make(map[rune]string)
+	for name, a := range texAccents {
+		marks[a.mark] = name
+	}
+	return marks
+}()
+
+// texEncodings maps the non-ASCII characters that EncodeTeX converts to
+// their TeX. Ligatures take precedence over symbols, symbols over
+// accented letters, and text mode over math mode. Among several commands
+// for a symbol, the text mode command with the "text" prefix is chosen,
+// or else the first in alphabetical order.
+var texEncodings = func() map[rune]string {
+	enc := make(map[rune]string)
+	single := func(s string) (rune, bool) {
+		r, n := utf8.DecodeRuneInString(s)
+		return r, n == len(s) && n > 0 && r >= utf8.RuneSelf
+	}
+	// accented letters, with the letters they are composed of first
+	accents := make(map[rune][2]string) // the accent and base of each letter
+	for name, a := range texAccents {
+		bases, composed := []rune(a.bases), []rune(a.composed)
+		for i, r := range composed {
+			accents[r] = [2]string{name, string(bases[i])}
+		}
+	}
+	var accented func(r rune) string
+	accented = func(r rune) string {
+		a, ok := accents[r]
+		if !ok {
+			return string(r)
+		}
+		base, _ := utf8.DecodeRuneInString(a[1])
+		return accentTeX(a[0], accented(base))
+	}
+	for r := range accents {
+		enc[r] = "{" + accented(r) + "}"
+	}
+	// symbols, replacing accented letters such as Å
+	names := slices.Sorted(maps.Keys(texSymbols))
+	slices.SortStableFunc(names, func(a, b string) int {
+		return cmpBool(strings.HasPrefix(b, "text"), strings.HasPrefix(a, "text"))
+	})
+	chosen := make(map[rune]bool)
+	for _, name := range names {
+		if r, ok := single(texSymbols[name]); ok && !chosen[r] {
+			enc[r] = `{\` + name + "}"
+			chosen[r] = true
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(texMathSymbols)) {
+		if r, ok := single(texMathSymbols[name]); ok && enc[r] == "" {
+			enc[r] = `$\` + name + "$"
+		}
+	}
+	enc['\u00a0'] = "~"
+	for _, l := range texLigatures {
+		if r, ok := single(l.text); ok {
+			enc[r] = l.tex
+		}
+	}
+	return enc
+}()
+
+// accentTeX returns the TeX for the accent command name applied to the
+// TeX base. Accent commands that are letters, such as \c, and bases
+// that are not single letters take their base in braces.
+func accentTeX(name, base string) string {
+	if !isLetter(name[0]) && len(base) == 1 {
+		return `\` + name + base
+	}
+	return `\` + name + "{" + base + "}"
+}
+
+// cmpBool compares booleans, with false before true.
+func cmpBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,127 @@
+package biblexer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// texSet maps TeX field content to its plain text.
+var texSet = map[string]string{
+	`M{\"u}ller`:                          "Müller",
+	`M\"uller`:                            "Müller",
+	`\'{e}t\'e`:                           "été",
+	`{\ss}`:                               "ß",
+	`Stra\ss e`:                           "Straße",
+	`Fish \& Chips`:                       "Fish & Chips",
+	`pages 1--10---or so`:                 "pages 1–10—or so",
+	`Donald~E. Knuth`:                     "Donald E. Knuth",
+	"``quoted''":                          "“quoted”",
+	`Ph.D.\ thesis`:                       "Ph.D. thesis",
+	`{\L}{\'o}d{\'z}`:                     "Łódź",
+	`\c{c}a, \c c\~ao`:                    "ça, ção",
+	`\v{S}koda \v Z`:                      "Škoda Ž",
+	`Erd\H{o}s`:                           "Erdős",
+	`{\'\i}ndice, \^{\i}le`:               "índice, île",
+	`Nguy\~{\^e}n \'{\^e}`:                "Nguyễn ế",
+	`\r{A}ngstr\"{o}m`:                    "Ångström",
+	`\k{a} \d{s} \b{k} \u{g} \={o} \.{z}`: "ą ṣ ḵ ğ ō ż",
+	`\t{oo}`:                              "o͡o",
+	`\'{x}`:                               "x́",
+	`The {Go} Programming   Language`:     "The Go Programming Language",
+	`\emph{Go} and {\it gophers}`:         "Go and gophers",
+	`$\alpha$-helix, $x^2 \leq 10$`:       "α-helix, x^2 ≤ 10",
+	`\noopsort{a}Zeta`:                    "Zeta",
+	`\url{https://go.dev}`:                "https://go.dev",
+	`\href{https://go.dev}{\textbf{Go}}`:  "Go",
+	`\enquote{yes}`:                       "“yes”",
+	`{\ae}sop {\O}re`:                     "æsop Øre",
+}
+
+func TestDecodeTeX(t *testing.T) {
+	for tex, expected := range texSet {
+		got, err := DecodeTeX(tex, PlainText)
+		if err != nil {
+			t.Errorf("Got error %v for %q", err, tex)
+		}
+		if got != expected {
+			t.Errorf("Got %q, expected %q", got, expected)
+		}
+	}
+}
+
+func TestDecodeTeXFormats(t *testing.T) {
+	tex := `\emph{Go} \& {\bf C\_lang} <x> \textsc{Ab} \href{https://go.dev}{Go\textsuperscript{2}}`
+	expected := map[TextFormat]string{
+		PlainText: "Go & C_lang <x> Ab Go2",
+		HTML:      `<em>Go</em> &amp; <b>C_lang</b> &lt;x&gt; <span style="font-variant:small-caps">Ab</span> <a href="https://go.dev">Go<sup>2</sup></a>`,
+		Markdown:  `*Go* & **C\_lang** \<x\> <span style="font-variant:small-caps">Ab</span> [Go<sup>2</sup>](https://go.dev)`,
+	}
+	for f, s := range expected {
+		got, err := DecodeTeX(tex, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != s {
+			t.Errorf("Got %q, expected %q", got, s)
+		}
+	}
+}
+
+func TestDecodeTeXUnknown(t *testing.T) {
+	got, err := DecodeTeX(`See \cite{knuth} and \cite{pike}, \foo.`, PlainText)
+	if expected := `See \cite{knuth} and \cite{pike}, \foo.`; got != expected {
+		t.Errorf("Got %q, expected %q", got, expected)
+	}
+	var uerr *UnknownCommandError
+	if !errors.As(err, &uerr) || len(uerr.Commands) != 2 || uerr.Commands[0] != `\cite` || uerr.Commands[1] != `\foo` {
+		t.Errorf("Got %v, expected unknown commands \\cite \\foo", err)
+	}
+}
+
+// unicodeSet maps Unicode text to its TeX.
+var unicodeSet = map[string]string{
+	"Müller":            `M{\"u}ller`,
+	"café, Ñandú":       `caf{\'e}, {\~N}and{\'u}`,
+	"Ørsted, Łódź":      `{\O}rsted, {\L}{\'o}d{\'z}`,
+	"Straße, Ægir, œuf": `Stra{\ss}e, {\AE}gir, {\oe}uf`,
+	"Škoda, Çelik":      `{\v{S}}koda, {\c{C}}elik`,
+	"Erdős, Ångström":   `Erd{\H{o}}s, {\AA}ngstr{\"o}m`,
+	"Nguyễn":            `Nguy{\~{\^e}}n`,
+	"1–10 — “quoted”":   "1--10 --- ``quoted''",
+	"Ph.D.\u00a0thesis": "Ph.D.~thesis",
+	"α-helix, a × b":    `$\alpha$-helix, a $\times$ b`,
+	"© 2020 §3":         `{\textcopyright} 2020 {\textsection}3`,
+	"plain ASCII {Go}":  "plain ASCII {Go}",
+}
+
+func TestEncodeTeX(t *testing.T) {
+	for s, expected := range unicodeSet {
+		got, err := EncodeTeX(s)
+		if err != nil {
+			t.Errorf("Got error %v for %q", err, s)
+		}
+		if got != expected {
+			t.Errorf("Got %q, expected %q", got, expected)
+		}
+		// decoding restores the text, except for the braces of {Go}
+		if back, err := DecodeTeX(got, PlainText); err != nil || back != strings.ReplaceAll(strings.ReplaceAll(s, "{", ""), "}", "") {
+			t.Errorf("Got %q, %v, expected %q", back, err, s)
+		}
+	}
+	// combining marks are converted like precomposed letters
+	if got, _ := EncodeTeX("Müller"); got != `M{\"u}ller` {
+		t.Errorf("Got %q, expected %q", got, `M{\"u}ller`)
+	}
+}
+
+func TestEncodeTeXUnmappable(t *testing.T) {
+	got, err := EncodeTeX("Go 囲碁 ü 碁")
+	if expected := `Go 囲碁 {\"u} 碁`; got != expected {
+		t.Errorf("Got %q, expected %q", got, expected)
+	}
+	var uerr *UnmappableCharError
+	if !errors.As(err, &uerr) || string(uerr.Chars) != "囲碁" {
+		t.Errorf("Got %v, expected unmappable characters 囲碁", err)
+	}
+}
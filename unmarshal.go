@@ -0,0 +1,252 @@
+package biblexer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	entryType = reflect.TypeFor[Entry]()
+	timeType  = reflect.TypeFor[time.Time]()
+	urlType   = reflect.TypeFor[url.URL]()
+	namesType = reflect.TypeFor[[]Name]()
+)
+
+// Unmarshal parses the .bib data and stores the entries in the value
+// pointed to by v. If v points to a slice, Unmarshal stores one element
+// for each entry; if v points to a struct, Unmarshal stores the first
+// entry. The elements may be structs, pointers to structs, or Entry.
+// Like encoding/json, Unmarshal allocates the values that nil pointers
+// in v point to.
+// The month macros are predefined, as in the standard BibTeX styles.
+//
+// Struct fields are filled from the entry fields named by their bibtex
+// struct tag, or else by the lower case field name. The tag "-" skips a
+// field, and the tags ",key" and ",type" select the cite key and entry
+// type. Besides strings and integers, fields may be time.Time for dates,
+// url.URL or *url.URL for links, []Name for name lists, and []string for
+// name lists, such as author and editor, or for comma separated lists,
+// such as keywords.
+// A time.Time field tagged "date" is filled from the date field or the
+// year, month and day fields.
+func Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("biblexer: Unmarshal(non-pointer %T)", v)
+	}
+	p := NewParser(NewLexer("", string(data)))
+	p.Macros().Enable(MonthMacros)
+	f, err := p.Parse()
+	if err != nil {
+		return err
+	}
+	var entries []*EntryNode
+	for _, n := range f.Nodes {
+		if n, ok := n.(*EntryNode); ok {
+			entries = append(entries, n)
+		}
+	}
+	dst := rv.Elem()
+	for dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+	switch dst.Kind() {
+	case reflect.Slice:
+		s := reflect.MakeSlice(dst.Type(), len(entries), len(entries))
+		for i, n := range entries {
+			elem := s.Index(i)
+			if elem.Kind() == reflect.Pointer {
+				elem.Set(reflect.New(elem.Type().Elem()))
+				elem = elem.Elem()
+			}
+			if err := unmarshalEntry(n, elem); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+		return nil
+	case reflect.Struct:
+		if len(entries) == 0 {
+			return nil
+		}
+		return unmarshalEntry(entries[0], dst)
+	}
+	return fmt.Errorf("biblexer: Unmarshal(unsupported type %T)", v)
+}
+
+// unmarshalEntry stores the entry n in the struct v.
+func unmarshalEntry(n *EntryNode, v reflect.Value) error {
+	e, err := DecodeEntry(n)
+	if v.Type() == entryType {
+		// as Decode does, store the entry even if it has invalid fields
+		v.Set(reflect.ValueOf(e))
+		return err
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("biblexer: cannot unmarshal entry into Go value of type %s", v.Type())
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, opt, ok := fieldTag(t.Field(i))
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		switch opt {
+		case "key":
+			if err := setString(fv, e.Key); err != nil {
+				return err
+			}
+			continue
+		case "type":
+			if err := setString(fv, e.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := unmarshalField(n, &e, name, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldTag returns the entry field name and option for the struct
+// field sf, and whether sf is to be marshaled and unmarshaled.
+func fieldTag(sf reflect.StructField) (name, opt string, ok bool) {
+	tag := sf.Tag.Get("bibtex")
+	if !sf.IsExported() || tag == "-" {
+		return "", "", false
+	}
+	name, opt, _ = strings.Cut(tag, ",")
+	if name == "" {
+		name = strings.ToLower(sf.Name)
+	}
+	return name, opt, true
+}
+
+// unmarshalField stores the named field of the entry e in v.
+func unmarshalField(n *EntryNode, e *Entry, name string, v reflect.Value) error {
+	if v.Type() == timeType && name == "date" {
+		date, bad, err := decodeDate(&e.Fields)
+		if err != nil {
+			return fieldError(n, bad, err)
+		}
+		v.Set(reflect.ValueOf(date))
+		return nil
+	}
+	s, ok := e.Fields.Lookup(name)
+	if !ok {
+		return nil
+	}
+	switch {
+	case v.Type() == timeType:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fieldError(n, name, errors.New("not a date"))
+	case v.Type() == urlType, v.Kind() == reflect.Pointer && v.Type().Elem() == urlType:
+		u, err := decodeURL(name, s)
+		if err != nil {
+			return fieldError(n, name, err)
+		}
+		if v.Kind() == reflect.Pointer {
+			v.Set(reflect.ValueOf(u))
+		} else {
+			v.Set(reflect.ValueOf(*u))
+		}
+		return nil
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+		return nil
+	case v.Type() == namesType:
+		v.Set(reflect.ValueOf(ParseNames(s)))
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var list []string
+		if isNameList(name) {
+			list = splitNames(s)
+		} else {
+			list = splitList(s)
+		}
+		l := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, s := range list {
+			l.Index(i).SetString(s)
+		}
+		v.Set(l)
+		return nil
+	case v.CanInt():
+		i, err := strconv.ParseInt(strings.Trim(s, "{} "), 10, v.Type().Bits())
+		if err != nil {
+			return fieldError(n, name, err)
+		}
+		v.SetInt(i)
+		return nil
+	}
+	return fmt.Errorf("biblexer: cannot unmarshal field %s into Go value of type %s", name, v.Type())
+}
+
+// setString stores s in v, which must be a string.
+func setString(v reflect.Value, s string) error {
+	if v.Kind() != reflect.String {
+		return fmt.Errorf("biblexer: cannot unmarshal string into Go value of type %s", v.Type())
+	}
+	v.SetString(s)
+	return nil
+}
+
+// isNameList reports whether the named field holds a list of
+// names separated by "and".
+func isNameList(name string) bool {
+	switch name {
+	case "author", "editor", "translator", "bookauthor", "editora", "editorb", "editorc":
+		return true
+	}
+	return false
+}
+
+// splitNames splits a list of names at each "and" that is surrounded
+// by white space and not enclosed in braces.
+func splitNames(s string) []string {
+	var names []string
+	braces, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '{':
+			braces++
+		case c == '}' && braces > 0:
+			braces--
+		case braces == 0 && isSpace(rune(c)) && i+4 < len(s) &&
+			strings.EqualFold(s[i+1:i+4], "and") && isSpace(rune(s[i+4])):
+			names = append(names, strings.TrimSpace(s[start:i]))
+			start = i + 4
+			i += 3
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(names) > 0 {
+		names = append(names, last)
+	}
+	return names
+}
+
+// splitList splits a list at each comma or semicolon.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,119 @@
+package biblexer
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type paper struct {
+	Key      string    `bibtex:",key"`
+	Type     string    `bibtex:",type"`
+	Authors  []string  `bibtex:"author"`
+	Title    string    `bibtex:"title"`
+	Date     time.Time `bibtex:"date"`
+	Keywords []string  `bibtex:"keywords"`
+	Link     *url.URL  `bibtex:"url"`
+	Volume   int
+	Ignored  string `bibtex:"-"`
+	internal string
+}
+
+var unmarshalInput = []byte(`@string{go = "The Go Team"}
+@article{meling72,
+	author = {Hein Meling and {Barnes and Noble} and } # go,
+	title = {The wonderful paper},
+	year = 1972, month = oct,
+	keywords = {go, bibtex; lexers},
+	url = {https://example.com/paper},
+	volume = 12,
+	ignored = {value},
+}
+@misc{k2, title = {Second}}
+`)
+
+func TestUnmarshal(t *testing.T) {
+	var papers []paper
+	if err := Unmarshal(unmarshalInput, &papers); err != nil {
+		t.Fatal(err)
+	}
+	if len(papers) != 2 {
+		t.Fatalf("Got %d papers, expected 2", len(papers))
+	}
+	p := papers[0]
+	if p.Key != "meling72" || p.Type != "article" || p.Title != "The wonderful paper" || p.Volume != 12 || p.Ignored != "" {
+		t.Errorf("Got %+v", p)
+	}
+	authors := []string{"Hein Meling", "{Barnes and Noble}", "The Go Team"}
+	if len(p.Authors) != len(authors) || p.Authors[0] != authors[0] || p.Authors[1] != authors[1] || p.Authors[2] != authors[2] {
+		t.Errorf("Got %q, expected %q", p.Authors, authors)
+	}
+	if len(p.Keywords) != 3 || p.Keywords[2] != "lexers" {
+		t.Errorf("Got %q, expected [go bibtex lexers]", p.Keywords)
+	}
+	if want := time.Date(1972, time.October, 1, 0, 0, 0, 0, time.UTC); !p.Date.Equal(want) {
+		t.Errorf("Got %v, expected %v", p.Date, want)
+	}
+	if p.Link == nil || p.Link.Path != "/paper" {
+		t.Errorf("Got %v, expected https://example.com/paper", p.Link)
+	}
+	if papers[1].Link != nil || !papers[1].Date.IsZero() {
+		t.Errorf("Got %+v, expected no link and no date", papers[1])
+	}
+
+	var first *paper
+	if err := Unmarshal(unmarshalInput, &first); err != nil || first == nil || first.Key != "meling72" {
+		t.Errorf("Got %+v (%v), expected meling72", first, err)
+	}
+	var one paper
+	if err := Unmarshal(unmarshalInput, &one); err != nil || one.Key != "meling72" {
+		t.Errorf("Got %+v (%v), expected meling72", one, err)
+	}
+	var entries []*Entry
+	if err := Unmarshal(unmarshalInput, &entries); err != nil || len(entries) != 2 || entries[0].Fields.Get("volume") != "12" {
+		t.Errorf("Got %v (%v), expected 2 entries", entries, err)
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	var papers []paper
+	err := Unmarshal([]byte(`@misc{k1, volume = {twelve}}`), &papers)
+	var ferr *FieldError
+	if !errors.As(err, &ferr) || ferr.Field != "volume" {
+		t.Errorf("Got %v, expected error for volume", err)
+	}
+	err = Unmarshal([]byte(`@misc{k1, title = {unterminated}`), &papers)
+	var serr *SyntaxError
+	if !errors.As(err, &serr) {
+		t.Errorf("Got %v, expected a *SyntaxError", err)
+	}
+	if err := Unmarshal(unmarshalInput, papers); err == nil {
+		t.Errorf("Expected error for non-pointer")
+	}
+	var entries []*Entry
+	err = Unmarshal([]byte(`@misc{k1, year = 2000, month = {foo}}`), &entries)
+	if !errors.As(err, &ferr) || ferr.Field != "month" {
+		t.Errorf("Got %v, expected error for month", err)
+	}
+}
+
+func TestUnmarshalNames(t *testing.T) {
+	var p struct {
+		Authors []Name `bibtex:"author"`
+	}
+	if err := Unmarshal([]byte(`@book{k, author = {Knuth, Donald E. and others}}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Authors) != 2 || p.Authors[0] != (Name{First: "Donald E.", Last: "Knuth"}) || !p.Authors[1].IsOthers() {
+		t.Errorf("Got %v, expected Knuth and others", p.Authors)
+	}
+	data, err := Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "author = {Knuth, Donald E. and others}"; !strings.Contains(string(data), expected) {
+		t.Errorf("Got %s, expected %s", data, expected)
+	}
+}